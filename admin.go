@@ -0,0 +1,205 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handle get email that failed to be sent
+func (s *APIServer) handleGetFailedEmails(w http.ResponseWriter, r *http.Request) error {
+	messages, err := s.store.GetFailedEmails()
+	if err != nil {
+		log.Println("1. handleGetFailedEmails", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, messages)
+}
+
+// handle get all city
+func (s *APIServer) handleAdminGetCities(w http.ResponseWriter, r *http.Request) error {
+	cities, err := s.store.GetAllCities()
+	if err != nil {
+		log.Println("1. handleAdminGetCities", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, cities)
+}
+
+// handle create new city
+func (s *APIServer) handleAdminCreateCity(w http.ResponseWriter, r *http.Request) error {
+	newCity := new(CreateNewCityType)
+	if err := decodeJSON(w, r, newCity); err != nil {
+		log.Println("1. handleAdminCreateCity", err)
+		return err
+	}
+
+	city, err := s.store.CreateNewCity(newCity)
+	if err != nil {
+		log.Println("2. handleAdminCreateCity", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusCreated, city)
+}
+
+// handle update city
+func (s *APIServer) handleAdminUpdateCity(w http.ResponseWriter, r *http.Request) error {
+	city_id := chi.URLParam(r, "city_id")
+
+	newCity := new(CreateNewCityType)
+	if err := decodeJSON(w, r, newCity); err != nil {
+		log.Println("1. handleAdminUpdateCity", err)
+		return err
+	}
+
+	city, err := s.store.UpdateCity(city_id, newCity)
+	if err != nil {
+		log.Println("2. handleAdminUpdateCity", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, city)
+}
+
+// handle delete city with its destination
+func (s *APIServer) handleAdminDeleteCity(w http.ResponseWriter, r *http.Request) error {
+	city_id := chi.URLParam(r, "city_id")
+
+	if err := s.store.DeleteCity(city_id); err != nil {
+		log.Println("1. handleAdminDeleteCity", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// handle get all destination of city
+func (s *APIServer) handleAdminGetDestinations(w http.ResponseWriter, r *http.Request) error {
+	city_id := chi.URLParam(r, "city_id")
+
+	destinations, err := s.store.GetDestinationsByCity(city_id)
+	if err != nil {
+		log.Println("1. handleAdminGetDestinations", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, destinations)
+}
+
+// handle create new destination
+func (s *APIServer) handleAdminCreateDestination(w http.ResponseWriter, r *http.Request) error {
+	newDes := new(CreateNewDestinationType)
+	if err := decodeJSON(w, r, newDes); err != nil {
+		log.Println("1. handleAdminCreateDestination", err)
+		return err
+	}
+
+	des, err := s.store.CreateNewDestination(newDes)
+	if err != nil {
+		log.Println("2. handleAdminCreateDestination", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusCreated, des)
+}
+
+// handle update destination
+func (s *APIServer) handleAdminUpdateDestination(w http.ResponseWriter, r *http.Request) error {
+	des_id := chi.URLParam(r, "destination_id")
+
+	newDes := new(CreateNewDestinationType)
+	if err := decodeJSON(w, r, newDes); err != nil {
+		log.Println("1. handleAdminUpdateDestination", err)
+		return err
+	}
+
+	des, err := s.store.UpdateDestination(des_id, newDes)
+	if err != nil {
+		log.Println("2. handleAdminUpdateDestination", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, des)
+}
+
+// handle delete destination with its image and user save
+func (s *APIServer) handleAdminDeleteDestination(w http.ResponseWriter, r *http.Request) error {
+	des_id := chi.URLParam(r, "destination_id")
+
+	if err := s.store.DeleteDestination(des_id); err != nil {
+		log.Println("1. handleAdminDeleteDestination", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// handle get all image of destination
+func (s *APIServer) handleAdminGetImages(w http.ResponseWriter, r *http.Request) error {
+	des_id := chi.URLParam(r, "destination_id")
+
+	if _, err := s.store.GetDestination(des_id); err != nil {
+		log.Println("1. handleAdminGetImages", err)
+		return err
+	}
+
+	images, err := s.store.GetAllImages(des_id)
+	if err != nil {
+		log.Println("2. handleAdminGetImages", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, images)
+}
+
+// handle create new image
+func (s *APIServer) handleAdminCreateImage(w http.ResponseWriter, r *http.Request) error {
+	newImg := new(CreateNewImageType)
+	if err := decodeJSON(w, r, newImg); err != nil {
+		log.Println("1. handleAdminCreateImage", err)
+		return err
+	}
+
+	img, err := s.store.CreateNewImage(newImg)
+	if err != nil {
+		log.Println("2. handleAdminCreateImage", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusCreated, img)
+}
+
+// handle update image
+func (s *APIServer) handleAdminUpdateImage(w http.ResponseWriter, r *http.Request) error {
+	image_id := chi.URLParam(r, "image_id")
+
+	newImg := new(CreateNewImageType)
+	if err := decodeJSON(w, r, newImg); err != nil {
+		log.Println("1. handleAdminUpdateImage", err)
+		return err
+	}
+
+	img, err := s.store.UpdateImage(image_id, newImg)
+	if err != nil {
+		log.Println("2. handleAdminUpdateImage", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, img)
+}
+
+// handle delete image
+func (s *APIServer) handleAdminDeleteImage(w http.ResponseWriter, r *http.Request) error {
+	image_id := chi.URLParam(r, "image_id")
+
+	if err := s.store.DeleteImage(image_id); err != nil {
+		log.Println("1. handleAdminDeleteImage", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sign in a new user with role, role is put in the token when it is created
+func (ts *testServer) signUpAs(t *testing.T, email, role string) string {
+	t.Helper()
+
+	acc := mustSignUp(t, ts.store, role, email)
+	if _, err := ts.store.UpdateUserRole(email, role); err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens map[string]any
+	if status := ts.request(t, "GET", "/auth/"+magicLinkToken(t, ts.store, acc.User_ID, time.Minute, time.Minute), "", nil, &tokens); status != http.StatusOK {
+		t.Fatalf("verify sign in %s: status %d", email, status)
+	}
+
+	token, _ := tokens["token"].(string)
+	return token
+}
+
+// every protected route group with every role. content is managed by editor and
+// failed email that contain user data only by admin
+func TestRequireRole(t *testing.T) {
+	ts := newTestServer(t)
+
+	user := ts.signUpAs(t, "user@example.com", roleUser)
+	editor := ts.signUpAs(t, "editor@example.com", roleEditor)
+	admin := ts.signUpAs(t, "admin@example.com", roleAdmin)
+
+	// token created before role is added has no role claim
+	acc := mustSignUp(t, ts.store, "Old", "old@example.com")
+	noRole, err := CreateJWT(acc.User_ID, "", uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	city := map[string]any{"city_name": "Bandung", "city_lat": -6.9, "city_long": 107.6}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+	}{
+		{"bookmark without token", "GET", "/bookmark", "", nil, http.StatusUnauthorized},
+		{"bookmark as user", "GET", "/bookmark", user, nil, http.StatusOK},
+
+		{"content without token", "GET", "/admin/cities", "", nil, http.StatusUnauthorized},
+		{"content as user", "GET", "/admin/cities", user, nil, http.StatusForbidden},
+		{"content without role", "GET", "/admin/cities", noRole, nil, http.StatusForbidden},
+		{"create content as user", "POST", "/admin/cities", user, city, http.StatusForbidden},
+		{"content as editor", "GET", "/admin/cities", editor, nil, http.StatusOK},
+		{"create content as editor", "POST", "/admin/cities", editor, city, http.StatusCreated},
+		{"content as admin", "GET", "/admin/cities", admin, nil, http.StatusOK},
+
+		{"outbox without token", "GET", "/admin/outbox/failed", "", nil, http.StatusUnauthorized},
+		{"outbox as user", "GET", "/admin/outbox/failed", user, nil, http.StatusForbidden},
+		{"outbox without role", "GET", "/admin/outbox/failed", noRole, nil, http.StatusForbidden},
+		{"outbox as editor", "GET", "/admin/outbox/failed", editor, nil, http.StatusForbidden},
+		{"outbox as admin", "GET", "/admin/outbox/failed", admin, nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := ts.request(t, tt.method, tt.path, tt.token, tt.body, nil); status != tt.status {
+				t.Errorf("status %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+// role is read again on refresh, so promote take effect without signing in again
+func TestRoleChangeOnRefresh(t *testing.T) {
+	ts := newTestServer(t)
+
+	acc := mustSignUp(t, ts.store, "Alice", "alice@example.com")
+
+	var tokens map[string]any
+	if status := ts.request(t, "GET", "/auth/"+magicLinkToken(t, ts.store, acc.User_ID, time.Minute, time.Minute), "", nil, &tokens); status != http.StatusOK {
+		t.Fatalf("verify sign in: status %d", status)
+	}
+
+	access, _ := tokens["token"].(string)
+	if status := ts.request(t, "GET", "/admin/cities", access, nil, nil); status != http.StatusForbidden {
+		t.Fatalf("before promote: status %d, want 403", status)
+	}
+
+	if _, err := ts.store.UpdateUserRole("alice@example.com", roleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := ts.request(t, "POST", "/auth/refresh", "", map[string]any{"refresh_token": tokens["refresh_token"]}, &tokens); status != http.StatusOK {
+		t.Fatalf("refresh: status %d", status)
+	}
+
+	access, _ = tokens["token"].(string)
+	if status := ts.request(t, "GET", "/admin/cities", access, nil, nil); status != http.StatusOK {
+		t.Errorf("after promote: status %d, want 200", status)
+	}
+}
+
+// editor update and delete city and destination, deleted destination is removed from bookmark
+func TestAdminUpdateAndDeleteContent(t *testing.T) {
+	ts := newTestServer(t)
+
+	user := ts.signUpAs(t, "user@example.com", roleUser)
+	editor := ts.signUpAs(t, "editor@example.com", roleEditor)
+
+	var city CityType
+	if status := ts.request(t, "POST", "/admin/cities", editor, map[string]any{"city_name": "Bandung", "city_lat": -6.9, "city_long": 107.6}, &city); status != http.StatusCreated {
+		t.Fatalf("create city: status %d", status)
+	}
+
+	destination := map[string]any{"destination_name": "Kawah Putih", "destination_lat": -7.16, "destination_long": 107.4, "city_id": city.City_ID}
+
+	var des DestinationType
+	if status := ts.request(t, "POST", "/admin/destinations", editor, destination, &des); status != http.StatusCreated {
+		t.Fatalf("create destination: status %d", status)
+	}
+
+	if status := ts.request(t, "POST", "/bookmark/create-and-save", user, map[string]string{"bookmark_name": "trip", "destination_id": des.Destination_ID}, nil); status != http.StatusOK {
+		t.Fatalf("save destination: status %d", status)
+	}
+
+	var bookmarks []*BookmarkType
+	if status := ts.request(t, "GET", "/bookmark", user, nil, &bookmarks); status != http.StatusOK || len(bookmarks) != 1 {
+		t.Fatalf("get bookmark: status %d, %+v", status, bookmarks)
+	}
+	saved := "/bookmark/specific/" + bookmarks[0].Bookmark_ID
+
+	unknown := uuid.New().String()
+	renamed := map[string]any{"destination_name": "Kawah Putih Ciwidey", "destination_lat": -7.16, "destination_long": 107.4, "city_id": city.City_ID}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+	}{
+		{"update city as user", "PUT", "/admin/cities/" + city.City_ID, user, map[string]any{"city_name": "Bandung Raya", "city_lat": -6.9, "city_long": 107.6}, http.StatusForbidden},
+		{"update city", "PUT", "/admin/cities/" + city.City_ID, editor, map[string]any{"city_name": "Bandung Raya", "city_lat": -6.9, "city_long": 107.6}, http.StatusOK},
+		{"update city invalid lat", "PUT", "/admin/cities/" + city.City_ID, editor, map[string]any{"city_name": "Bandung", "city_lat": 91, "city_long": 107.6}, http.StatusUnprocessableEntity},
+		{"update unknown city", "PUT", "/admin/cities/" + unknown, editor, map[string]any{"city_name": "Bandung", "city_lat": -6.9, "city_long": 107.6}, http.StatusNotFound},
+
+		{"update destination as user", "PUT", "/admin/destinations/" + des.Destination_ID, user, renamed, http.StatusForbidden},
+		{"update destination", "PUT", "/admin/destinations/" + des.Destination_ID, editor, renamed, http.StatusOK},
+		{"update destination unknown city", "PUT", "/admin/destinations/" + des.Destination_ID, editor, map[string]any{"destination_name": "Kawah Putih", "destination_lat": -7.16, "destination_long": 107.4, "city_id": unknown}, http.StatusUnprocessableEntity},
+		{"update unknown destination", "PUT", "/admin/destinations/" + unknown, editor, renamed, http.StatusNotFound},
+
+		{"delete destination as user", "DELETE", "/admin/destinations/" + des.Destination_ID, user, nil, http.StatusForbidden},
+		{"delete destination", "DELETE", "/admin/destinations/" + des.Destination_ID, editor, nil, http.StatusOK},
+		{"delete deleted destination", "DELETE", "/admin/destinations/" + des.Destination_ID, editor, nil, http.StatusNotFound},
+
+		{"delete city as user", "DELETE", "/admin/cities/" + city.City_ID, user, nil, http.StatusForbidden},
+		{"delete city", "DELETE", "/admin/cities/" + city.City_ID, editor, nil, http.StatusOK},
+		{"delete deleted city", "DELETE", "/admin/cities/" + city.City_ID, editor, nil, http.StatusNotFound},
+		{"destinations of deleted city", "GET", "/admin/cities/" + city.City_ID + "/destinations", editor, nil, http.StatusNotFound},
+	}
+
+	// subtests run in order, each step depends on the one before
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := ts.request(t, tt.method, tt.path, tt.token, tt.body, nil); status != tt.status {
+				t.Errorf("status %d, want %d", status, tt.status)
+			}
+		})
+
+		switch tt.name {
+		case "update destination":
+			var got DestinationType
+			if status := ts.request(t, "GET", "/destination/specific/"+des.Destination_ID, user, nil, &got); status != http.StatusOK || got.Destination_Name != "Kawah Putih Ciwidey" {
+				t.Errorf("destination after update: status %d, %+v", status, got)
+			}
+		case "delete destination":
+			var data []*SendDataUser_SaveType
+			if status := ts.request(t, "GET", saved, user, nil, &data); status != http.StatusOK || len(data) != 0 {
+				t.Errorf("bookmark after delete destination: status %d, %+v", status, data)
+			}
+		}
+	}
+}
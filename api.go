@@ -1,40 +1,56 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-
 type APIServer struct {
 	listenAddr string
+	config     *Config
 	store      Storage
-	user_id    string
+	mailer     Mailer
+	emails     *EmailTemplates
 }
 
-func NewApiServer(listenAddr string, storage Storage) *APIServer {
+func NewApiServer(config *Config, storage Storage, mailer Mailer, emails *EmailTemplates) *APIServer {
 	return &APIServer{
-		listenAddr: listenAddr,
+		listenAddr: "0.0.0.0:" + config.Port,
+		config:     config,
 		store:      storage,
+		mailer:     mailer,
+		emails:     emails,
 	}
 }
 
-func (s *APIServer) Run() {
+// use default image for destination without image, stay null if not configured
+func (s *APIServer) coverImage(url *string) *string {
+	if url == nil && s.config.Default_Image_URL != "" {
+		return &s.config.Default_Image_URL
+	}
+
+	return url
+}
+
+// handler of every route
+func (s *APIServer) routes() http.Handler {
 	router := chi.NewRouter()
 
+	router.Use(RealIP(s.config.TrustedProxies()))
 	router.Use(middleware.Logger)
 
 	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://roadtrip.vercel.app/", "https://roadtrip-laannen-gmailcom.vercel.app", "https://roadtrip-q7ki6cz9s-laannen-gmailcom.vercel.app", "https://roadtrip-git-main-laannen-gmailcom.vercel.app"},
+		AllowOriginFunc:  s.config.AllowOrigin,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		AllowCredentials: true,
@@ -44,10 +60,16 @@ func (s *APIServer) Run() {
 	router.Post("/signup", makeHTTPHandleFunc(s.handleSignUp))
 	router.Post("/signin", makeHTTPHandleFunc(s.handleSignIn))
 	router.Get("/auth/{token}", makeHTTPHandleFunc(s.handleVerifySignIn))
+	router.Post("/auth/refresh", makeHTTPHandleFunc(s.handleRefreshToken))
+	router.Get("/auth/csrf", makeHTTPHandleFunc(s.handleGetCSRFToken))
 
 	router.Group(func(r chi.Router) {
-		r.Use(WithJWTAuth)
-		r.Get("/logout", makeHTTPHandleFunc(s.handleLogout))
+		r.Use(s.WithJWTAuth)
+		r.Post("/logout", makeHTTPHandleFunc(s.handleLogout))
+		r.Post("/logout/all", makeHTTPHandleFunc(s.handleLogoutAll))
+		r.Put("/account/locale", makeHTTPHandleFunc(s.handleUpdateLocale))
+		r.Get("/sessions", makeHTTPHandleFunc(s.handleGetSessions))
+		r.Delete("/sessions/{session_id}", makeHTTPHandleFunc(s.handleDeleteSession))
 		r.Get("/destination/{city}", makeHTTPHandleFunc(s.handleGetAllDestination))
 		r.Get("/destination/specific/{destination_id}", makeHTTPHandleFunc(s.handleGetDestination))
 		r.Post("/bookmark", makeHTTPHandleFunc(s.handleCreateNewBookmark))
@@ -60,9 +82,69 @@ func (s *APIServer) Run() {
 		r.Delete("/bookmark/specific/{destination_book_id}", makeHTTPHandleFunc(s.handleDeleteBookmarkDestination))
 	})
 
-	log.Println("Server running in Port:", s.listenAddr)
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(s.WithJWTAuth)
+
+		// content of city, destination and image is managed by editor
+		r.Group(func(r chi.Router) {
+			r.Use(RequireRole(roleEditor))
+			r.Get("/cities", makeHTTPHandleFunc(s.handleAdminGetCities))
+			r.Post("/cities", makeHTTPHandleFunc(s.handleAdminCreateCity))
+			r.Put("/cities/{city_id}", makeHTTPHandleFunc(s.handleAdminUpdateCity))
+			r.Delete("/cities/{city_id}", makeHTTPHandleFunc(s.handleAdminDeleteCity))
+			r.Get("/cities/{city_id}/destinations", makeHTTPHandleFunc(s.handleAdminGetDestinations))
+
+			r.Post("/destinations", makeHTTPHandleFunc(s.handleAdminCreateDestination))
+			r.Put("/destinations/{destination_id}", makeHTTPHandleFunc(s.handleAdminUpdateDestination))
+			r.Delete("/destinations/{destination_id}", makeHTTPHandleFunc(s.handleAdminDeleteDestination))
+			r.Get("/destinations/{destination_id}/images", makeHTTPHandleFunc(s.handleAdminGetImages))
+
+			r.Post("/images", makeHTTPHandleFunc(s.handleAdminCreateImage))
+			r.Put("/images/{image_id}", makeHTTPHandleFunc(s.handleAdminUpdateImage))
+			r.Delete("/images/{image_id}", makeHTTPHandleFunc(s.handleAdminDeleteImage))
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequireRole(roleAdmin))
+			r.Get("/outbox/failed", makeHTTPHandleFunc(s.handleGetFailedEmails))
+		})
+	})
 
-	http.ListenAndServe(s.listenAddr, router)
+	return router
+}
+
+// serve until ctx is done, then wait for running request to finish
+func (s *APIServer) Run(ctx context.Context) error {
+	go s.cleanupExpiredTokens(ctx, time.Hour)
+
+	server := &http.Server{Addr: s.listenAddr, Handler: s.routes()}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Println("Server running in Port:", s.listenAddr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Server shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
 }
 
 func (s *APIServer) handleWelcome(w http.ResponseWriter, r *http.Request) error {
@@ -71,23 +153,23 @@ func (s *APIServer) handleWelcome(w http.ResponseWriter, r *http.Request) error
 
 func (s *APIServer) handleSignUp(w http.ResponseWriter, r *http.Request) error {
 	newAccount := new(SignUpType)
-	if err := json.NewDecoder(r.Body).Decode(newAccount); err != nil {
+	if err := decodeJSON(w, r, newAccount); err != nil {
 		return err
 	}
 
 	defer r.Body.Close()
 
 	account, err := s.store.SignUp(newAccount)
-	if err != nil {
-		return err
+
+	if IsErrorKind(err, KindConflict) && s.config.Signup_Existing_Send_Signin {
+		account, err = s.store.CheckEmail(newAccount.Email)
 	}
 
-	tokenStr, err := CreateJWT(account.User_ID)
 	if err != nil {
 		return err
 	}
 
-	if err := SendMAIL(account.Email, account.User_Name, tokenStr); err != nil {
+	if err := s.sendSignInLink(account, emailLocale(r, account)); err != nil {
 		return err
 	}
 
@@ -96,31 +178,68 @@ func (s *APIServer) handleSignUp(w http.ResponseWriter, r *http.Request) error {
 
 func (s *APIServer) handleSignIn(w http.ResponseWriter, r *http.Request) error {
 	email := new(SignInType)
-	if err := json.NewDecoder(r.Body).Decode(email); err != nil {
+	if err := decodeJSON(w, r, email); err != nil {
 		log.Println("1. handleSignIn", err)
 		return err
 	}
 	defer r.Body.Close()
 
 	account, err := s.store.CheckEmail(email.Email)
+
+	// same response as a registered email, so sign in can not be used to find registered email
+	if IsErrorKind(err, KindNotFound) {
+		return WriteJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	}
+
 	if err != nil {
 		log.Println("2. handleSignIn", err)
 		return err
 	}
 
-	// create token
-	tokenStr, err := CreateJWT(account.User_ID)
-	if err != nil {
+	if err := s.sendSignInLink(account, emailLocale(r, account)); err != nil {
 		log.Println("3. handleSignIn", err)
 		return err
 	}
 
-	if err := SendMAIL(account.Email, account.User_Name, tokenStr); err != nil {
-		log.Println("4. handleSignIn", err)
+	return WriteJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// frontend page that exchange the token
+func (s *APIServer) signInLink(token string) string {
+	return s.config.App_URL + "/auth/" + url.PathEscape(token)
+}
+
+// create single use sign in link and send it to account email
+func (s *APIServer) sendSignInLink(account *AccountType, locale string) error {
+	link := &MagicLinkType{
+		Nonce:      uuid.New().String(),
+		User_ID:    account.User_ID,
+		Expires_At: time.Now().Add(magicLinkExpiry).Unix(),
+	}
+
+	if err := s.store.SaveMagicLink(link); err != nil {
 		return err
 	}
 
-	return WriteJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	token, err := CreateMagicLinkJWT(link)
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.emails.Render("signin", locale, &EmailData{
+		User_Name:  account.User_Name,
+		Link:       s.signInLink(token),
+		Expires_In: int(magicLinkExpiry.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.To = account.Email
+	msg.To_Name = account.User_Name
+	msg.Expires_At = link.Expires_At
+
+	return s.mailer.Send(msg)
 }
 
 func (s *APIServer) handleVerifySignIn(w http.ResponseWriter, r *http.Request) error {
@@ -128,33 +247,330 @@ func (s *APIServer) handleVerifySignIn(w http.ResponseWriter, r *http.Request) e
 
 	claims := new(ClaimsType)
 
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
+	token, err := jwt.ParseWithClaims(tokenStr, claims, jwtKeys.KeyFunc)
+
+	if err != nil {
+		log.Println("1. handleVerifySignIn", err)
+		return tokenError(err)
+	}
+
+	if !token.Valid || claims.Token_Type != tokenTypeMagicLink {
+		return invalidTokenError("token invalid")
+	}
+
+	// sign in link can only be used once
+	link, err := s.store.ConsumeMagicLink(claims.ID)
+	if err != nil {
+		log.Println("2. handleVerifySignIn", err)
+		return err
+	}
+
+	if link.User_ID != claims.User_ID {
+		return UnauthorizedError("token invalid")
+	}
+
+	// exchange sign in link with a new session
+	now := time.Now().Unix()
+	sess := &SessionType{
+		Session_ID:   uuid.New().String(),
+		User_ID:      link.User_ID,
+		User_Agent:   truncate(r.UserAgent(), 500),
+		IP:           truncate(clientIP(r), 100),
+		Created_At:   now,
+		Last_Seen_At: now,
+	}
+
+	if err := s.store.CreateSession(sess); err != nil {
+		log.Println("3. handleVerifySignIn", err)
+		return err
+	}
+
+	if err := s.writeSessionTokens(w, link.User_ID, sess.Session_ID); err != nil {
+		log.Println("4. handleVerifySignIn", err)
+		return err
+	}
+
+	return nil
+}
+
+// create access token and refresh token of a session, send as json or cookie
+func (s *APIServer) writeSessionTokens(w http.ResponseWriter, user_id, session_id string) error {
+	// role is read here so a changed role is used from the next refresh
+	account, err := s.store.GetAccount(user_id)
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := CreateJWT(user_id, account.Role, session_id)
+	if err != nil {
+		return err
+	}
+
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	refresh := &RefreshTokenType{
+		Token_Hash: refreshHash,
+		Session_ID: session_id,
+		User_ID:    user_id,
+		Expires_At: time.Now().Add(refreshTokenTTL).Unix(),
+	}
+
+	if err := s.store.SaveRefreshToken(refresh); err != nil {
+		return err
+	}
+
+	if s.config.Auth_Cookie.Enabled {
+		sameSite := s.config.Auth_Cookie.SameSite()
+
+		// frontend is on other site and can not read our cookie, so the csrf token is also in the body
+		csrfToken, err := randomToken()
+		if err != nil {
+			return err
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     accessTokenCookie,
+			Value:    accessToken,
+			Path:     "/",
+			MaxAge:   int(accessTokenTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: sameSite,
+		})
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     refreshTokenCookie,
+			Value:    refreshToken,
+			Path:     "/auth/refresh",
+			MaxAge:   int(refreshTokenTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: sameSite,
+		})
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfTokenCookie,
+			Value:    csrfToken,
+			Path:     "/",
+			MaxAge:   int(refreshTokenTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: sameSite,
+		})
+
+		return WriteJSON(w, http.StatusOK, map[string]any{"status": "ok", "csrf_token": csrfToken, "expires_in": int(accessTokenTTL.Seconds())})
+	}
+
+	return WriteJSON(w, http.StatusOK, map[string]any{
+		"status":        "ok",
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL.Seconds()),
 	})
+}
 
+// handle refresh token rotation, reused refresh token revoke the whole session
+func (s *APIServer) handleRefreshToken(w http.ResponseWriter, r *http.Request) error {
+	req := new(RefreshTokenRequestType)
+
+	// body can be empty in cookie mode
+	if err := decodeOptionalJSON(w, r, req); err != nil {
+		log.Println("1. handleRefreshToken", err)
+		return err
+	}
+
+	if req.Refresh_Token == "" && s.config.Auth_Cookie.Enabled {
+		if cookie, err := r.Cookie(refreshTokenCookie); err == nil {
+			if err := checkCSRF(r); err != nil {
+				return err
+			}
+
+			req.Refresh_Token = cookie.Value
+		}
+	}
+
+	if req.Refresh_Token == "" {
+		return UnauthorizedError("no refresh token")
+	}
+
+	refresh, err := s.store.GetRefreshToken(hashToken(req.Refresh_Token))
 	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			log.Println("1. handleVerifySignIn", err)
-			return WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "Signature Invalid"})
+		log.Println("2. handleRefreshToken", err)
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	if refresh.Revoked_At != nil {
+		return UnauthorizedError("session revoked")
+	}
+
+	// token is already rotated, someone else has it so revoke the session
+	if refresh.Used_At != nil {
+		if err := s.store.RevokeRefreshSession(refresh.Session_ID, now); err != nil {
+			log.Println("3. handleRefreshToken", err)
+			return err
 		}
 
-		log.Println("2. handleVerifySignIn", err)
-		return WriteJSON(w, http.StatusUnauthorized, ApiError{Error: err.Error()})
+		return UnauthorizedError("refresh token reused, session revoked")
+	}
+
+	if refresh.Expires_At <= now {
+		return UnauthorizedError("refresh token expired")
+	}
+
+	ok, err := s.store.UseRefreshToken(refresh.Token_Hash, now)
+	if err != nil {
+		log.Println("4. handleRefreshToken", err)
+		return err
+	}
+
+	// other request used the token at the same time
+	if !ok {
+		if err := s.store.RevokeRefreshSession(refresh.Session_ID, now); err != nil {
+			log.Println("5. handleRefreshToken", err)
+			return err
+		}
+
+		return UnauthorizedError("refresh token reused, session revoked")
 	}
 
-	if !token.Valid {
-		return WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "token invalid"})
+	return s.writeSessionTokens(w, refresh.User_ID, refresh.Session_ID)
+}
+
+// handle get csrf token of cookie mode again, like after the page is reloaded.
+// cors only let allowed origin read the response
+func (s *APIServer) handleGetCSRFToken(w http.ResponseWriter, r *http.Request) error {
+	cookie, err := r.Cookie(csrfTokenCookie)
+	if !s.config.Auth_Cookie.Enabled || err != nil {
+		return UnauthorizedError("no csrf cookie")
 	}
 
-	s.user_id = claims.User_ID
-	return WriteJSON(w, http.StatusOK, map[string]string{"status": "ok", "token": tokenStr})
+	return WriteJSON(w, http.StatusOK, map[string]string{"csrf_token": cookie.Value})
 }
 
+// revoke current access token and its session
 func (s *APIServer) handleLogout(w http.ResponseWriter, r *http.Request) error {
-	s.user_id = ""
+	claims := getClaims(r)
+
+	if err := s.store.RevokeToken(claims.ID, claims.ExpiresAt.Unix()); err != nil {
+		log.Println("1. handleLogout", err)
+		return err
+	}
+
+	if err := s.store.RevokeRefreshSession(claims.Session_ID, time.Now().Unix()); err != nil {
+		log.Println("2. handleLogout", err)
+		return err
+	}
+
+	s.clearAuthCookies(w)
+
+	return WriteJSON(w, http.StatusOK, map[string]string{"status": "Logout success"})
+}
+
+// revoke every session of the signed in user
+func (s *APIServer) handleLogoutAll(w http.ResponseWriter, r *http.Request) error {
+	claims := getClaims(r)
+
+	if err := s.store.RevokeToken(claims.ID, claims.ExpiresAt.Unix()); err != nil {
+		log.Println("1. handleLogoutAll", err)
+		return err
+	}
+
+	if err := s.store.RevokeUserSessions(claims.User_ID, time.Now().Unix()); err != nil {
+		log.Println("2. handleLogoutAll", err)
+		return err
+	}
+
+	s.clearAuthCookies(w)
+
 	return WriteJSON(w, http.StatusOK, map[string]string{"status": "Logout success"})
 }
 
+// handle change preferred language of email
+func (s *APIServer) handleUpdateLocale(w http.ResponseWriter, r *http.Request) error {
+	locale := new(UpdateLocaleType)
+	if err := decodeJSON(w, r, locale); err != nil {
+		log.Println("1. handleUpdateLocale", err)
+		return err
+	}
+	defer r.Body.Close()
+
+	if err := s.store.UpdateUserLocale(getUserID(r), locale.Locale); err != nil {
+		log.Println("2. handleUpdateLocale", err)
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, map[string]string{"status": "success", "locale": locale.Locale})
+}
+
+// handle get all active session of the signed in user
+func (s *APIServer) handleGetSessions(w http.ResponseWriter, r *http.Request) error {
+	claims := getClaims(r)
+
+	sessions, err := s.store.GetAllSessions(claims.User_ID, time.Now().Unix())
+	if err != nil {
+		log.Println("1. handleGetSessions", err)
+		return err
+	}
+
+	for _, sess := range sessions {
+		sess.Current = sess.Session_ID == claims.Session_ID
+	}
+
+	return WriteJSON(w, http.StatusOK, sessions)
+}
+
+// handle revoke a session of the signed in user
+func (s *APIServer) handleDeleteSession(w http.ResponseWriter, r *http.Request) error {
+	session_id := chi.URLParam(r, "session_id")
+
+	if err := s.store.RevokeSession(getUserID(r), session_id, time.Now().Unix()); err != nil {
+		log.Println("1. handleDeleteSession", err)
+		return err
+	}
+
+	// current session is revoked, remove the cookie too
+	if session_id == getClaims(r).Session_ID {
+		s.clearAuthCookies(w)
+	}
+
+	return WriteJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// remove token cookie in cookie mode
+func (s *APIServer) clearAuthCookies(w http.ResponseWriter) {
+	if !s.config.Auth_Cookie.Enabled {
+		return
+	}
+
+	sameSite := s.config.Auth_Cookie.SameSite()
+
+	http.SetCookie(w, &http.Cookie{Name: accessTokenCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: sameSite})
+	http.SetCookie(w, &http.Cookie{Name: refreshTokenCookie, Path: "/auth/refresh", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: sameSite})
+	http.SetCookie(w, &http.Cookie{Name: csrfTokenCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: sameSite})
+}
+
+// delete expired denylist periodically
+func (s *APIServer) cleanupExpiredTokens(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.store.DeleteExpiredTokens(time.Now().Unix()); err != nil {
+				log.Println("cleanupExpiredTokens", err)
+			}
+		}
+	}
+}
+
 // handle GET ALL DATA DESTINATION
 func (s *APIServer) handleGetAllDestination(w http.ResponseWriter, r *http.Request) error {
 	// get param city
@@ -162,7 +578,7 @@ func (s *APIServer) handleGetAllDestination(w http.ResponseWriter, r *http.Reque
 	cityParam, err := url.QueryUnescape(param)
 	if err != nil {
 		log.Println("1. handleGetAllDestination", err)
-		return err
+		return BadRequestError("city: %s invalid", param)
 	}
 
 	// check if there is city in database or not
@@ -179,6 +595,10 @@ func (s *APIServer) handleGetAllDestination(w http.ResponseWriter, r *http.Reque
 		return err
 	}
 
+	for _, d := range allDestination {
+		d.Image_URL = s.coverImage(d.Image_URL)
+	}
+
 	sendAllData := &SendAllDestinationType{
 		City_Name:        city.City_Name,
 		City_Lat:         city.City_Lat,
@@ -222,12 +642,12 @@ func (s *APIServer) handleGetDestination(w http.ResponseWriter, r *http.Request)
 func (s *APIServer) handleCreateNewBookmark(w http.ResponseWriter, r *http.Request) error {
 	// read data from the body
 	book := new(NewBookmarkType)
-	if err := json.NewDecoder(r.Body).Decode(book); err != nil {
+	if err := decodeJSON(w, r, book); err != nil {
 		log.Println("1. handleCreateNewBookmark", err)
 		return err
 	}
 
-	book.User_ID = s.user_id
+	book.User_ID = getUserID(r)
 
 	defer r.Body.Close()
 
@@ -242,7 +662,7 @@ func (s *APIServer) handleCreateNewBookmark(w http.ResponseWriter, r *http.Reque
 
 // handle get all bookmark name
 func (s *APIServer) handleGetBookmarkName(w http.ResponseWriter, r *http.Request) error {
-	bookmarks, err := s.store.GetAllBookmark(s.user_id)
+	bookmarks, err := s.store.GetAllBookmark(getUserID(r))
 	if err != nil {
 		log.Println("3. handleCreateNewBookmark", err)
 		return err
@@ -254,12 +674,12 @@ func (s *APIServer) handleGetBookmarkName(w http.ResponseWriter, r *http.Request
 // handle save data into bookmark
 func (s *APIServer) handleSaveIntoBookmark(w http.ResponseWriter, r *http.Request) error {
 	newSave := new(CreateNewUser_SaveType)
-	if err := json.NewDecoder(r.Body).Decode(newSave); err != nil {
+	if err := decodeJSON(w, r, newSave); err != nil {
 		log.Println("1. handleSaveIntoBookmark", err)
 		return err
 	}
 
-	if err := s.store.SaveBookmarkData(newSave); err != nil {
+	if err := s.store.SaveBookmarkData(getUserID(r), newSave); err != nil {
 		log.Println("2. handleSaveIntoBookmark", err)
 		return err
 	}
@@ -270,31 +690,33 @@ func (s *APIServer) handleSaveIntoBookmark(w http.ResponseWriter, r *http.Reques
 // handle create new bookmark and save data
 func (s *APIServer) handleCreateAndSaveIntoBookmark(w http.ResponseWriter, r *http.Request) error {
 	newBookReq := new(CreateBookmarkAndSaveType)
-	if err := json.NewDecoder(r.Body).Decode(newBookReq); err != nil {
+	if err := decodeJSON(w, r, newBookReq); err != nil {
 		log.Println("1. handleCreateAndSaveIntoBookmark", err)
 		return err
 	}
 
-	// create bookmark
-	newBookData := &NewBookmarkType{
-		User_ID:       newBookReq.User_ID,
-		Bookmark_Name: newBookReq.Bookmark_Name,
-	}
+	// create bookmark and save data in one transaction
+	err := s.store.WithTx(func(tx Storage) error {
+		newBookData := &NewBookmarkType{
+			User_ID:       getUserID(r),
+			Bookmark_Name: newBookReq.Bookmark_Name,
+		}
 
-	newBook, err := s.store.CreateNewBookmark(newBookData)
-	if err != nil {
-		log.Println("2. handleCreateAndSaveIntoBookmark", err)
-		return err
-	}
+		newBook, err := tx.CreateNewBookmark(newBookData)
+		if err != nil {
+			return err
+		}
 
-	// save data
-	newSaveData := &CreateNewUser_SaveType{
-		Destination_ID: newBookReq.Destination_ID,
-		Bookmark_ID:    newBook.Bookmark_ID,
-	}
+		newSaveData := &CreateNewUser_SaveType{
+			Destination_ID: newBookReq.Destination_ID,
+			Bookmark_ID:    newBook.Bookmark_ID,
+		}
 
-	if err := s.store.SaveBookmarkData(newSaveData); err != nil {
-		log.Println("3. handleCreateAndSaveIntoBookmark", err)
+		return tx.SaveBookmarkData(getUserID(r), newSaveData)
+	})
+
+	if err != nil {
+		log.Println("2. handleCreateAndSaveIntoBookmark", err)
 		return err
 	}
 
@@ -306,13 +728,13 @@ func (s *APIServer) handleBookmarkUpdateName(w http.ResponseWriter, r *http.Requ
 	bookID := chi.URLParam(r, "bookmark_id")
 
 	bookNewName := new(UpdateBookmarkNameType)
-	if err := json.NewDecoder(r.Body).Decode(bookNewName); err != nil {
+	if err := decodeJSON(w, r, bookNewName); err != nil {
 		log.Println("1. handleBookmarkUpdateName", err)
 		return err
 	}
 
 	// update
-	if err := s.store.UpdateBookmarkName(bookID, bookNewName); err != nil {
+	if err := s.store.UpdateBookmarkName(getUserID(r), bookID, bookNewName); err != nil {
 		log.Println("2. handleBookmarkUpdateName", err)
 		return err
 	}
@@ -324,12 +746,16 @@ func (s *APIServer) handleBookmarkUpdateName(w http.ResponseWriter, r *http.Requ
 func (s *APIServer) handleGetBookmarkData(w http.ResponseWriter, r *http.Request) error {
 	bookmark_id := chi.URLParam(r, "bookmark_id")
 
-	user_save_data, err := s.store.GetAllDataByBookmark(bookmark_id)
+	user_save_data, err := s.store.GetAllDataByBookmark(getUserID(r), bookmark_id)
 	if err != nil {
 		log.Println("1. handleGetBookmarkData", err)
 		return err
 	}
 
+	for _, u := range user_save_data {
+		u.Image_URL = s.coverImage(u.Image_URL)
+	}
+
 	return WriteJSON(w, http.StatusOK, user_save_data)
 }
 
@@ -337,7 +763,7 @@ func (s *APIServer) handleGetBookmarkData(w http.ResponseWriter, r *http.Request
 func (s *APIServer) handleDeleteBookmarkName(w http.ResponseWriter, r *http.Request) error {
 	bookmark_id := chi.URLParam(r, "bookmark_id")
 
-	if err := s.store.DeleteBookmark(bookmark_id); err != nil {
+	if err := s.store.DeleteBookmark(getUserID(r), bookmark_id); err != nil {
 		log.Println("1. handleDeleteBookmarkName", err)
 		return err
 	}
@@ -349,7 +775,7 @@ func (s *APIServer) handleDeleteBookmarkName(w http.ResponseWriter, r *http.Requ
 func (s *APIServer) handleDeleteBookmarkDestination(w http.ResponseWriter, r *http.Request) error {
 	user_dave_id := chi.URLParam(r, "destination_book_id")
 
-	if err := s.store.DeleteBookmarkData(user_dave_id); err != nil {
+	if err := s.store.DeleteBookmarkData(getUserID(r), user_dave_id); err != nil {
 		log.Println("1. handleDeleteBookmarkDestination", err)
 		return err
 	}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// two user use the api at the same time, each only see their own bookmark
+func TestBookmarkIsolation(t *testing.T) {
+	ts := newTestServer(t)
+
+	users := map[string]string{
+		"alice": ts.signUp(t, "Alice", "alice@example.com"),
+		"bob":   ts.signUp(t, "Bob", "bob@example.com"),
+	}
+
+	const count = 20
+
+	var wg sync.WaitGroup
+	for name, token := range users {
+		wg.Add(1)
+		go func(name, token string) {
+			defer wg.Done()
+
+			for i := 0; i < count; i++ {
+				book := map[string]string{"bookmark_name": fmt.Sprintf("%s-%d", name, i)}
+				// t.Fatal is not allowed outside the test goroutine
+				if status, err := ts.send("POST", "/bookmark", token, book, nil); err != nil || status != http.StatusOK {
+					t.Errorf("%s create bookmark: status %d, %v", name, status, err)
+				}
+			}
+		}(name, token)
+	}
+	wg.Wait()
+
+	for name, token := range users {
+		var bookmarks []*BookmarkType
+		if status := ts.request(t, "GET", "/bookmark", token, nil, &bookmarks); status != http.StatusOK {
+			t.Fatalf("%s get bookmark: status %d", name, status)
+		}
+
+		if len(bookmarks) != count {
+			t.Errorf("%s got %d bookmark, want %d", name, len(bookmarks), count)
+		}
+
+		seen := map[string]bool{}
+		for _, book := range bookmarks {
+			seen[book.Bookmark_Name] = true
+		}
+
+		for i := 0; i < count; i++ {
+			if want := fmt.Sprintf("%s-%d", name, i); !seen[want] {
+				t.Errorf("%s missing bookmark %s", name, want)
+			}
+		}
+
+		for other := range users {
+			if other != name && seen[other+"-0"] {
+				t.Errorf("%s can see bookmark of %s", name, other)
+			}
+		}
+	}
+}
+
+// bookmark of other user is not found, same as a bookmark that does not exist
+func TestBookmarkOfOtherUser(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp(t, "Alice", "alice@example.com")
+	bob := ts.signUp(t, "Bob", "bob@example.com")
+
+	if status := ts.request(t, "POST", "/bookmark", alice, map[string]string{"bookmark_name": "trip"}, nil); status != http.StatusOK {
+		t.Fatalf("create bookmark: status %d", status)
+	}
+
+	var bookmarks []*BookmarkType
+	if status := ts.request(t, "GET", "/bookmark", alice, nil, &bookmarks); status != http.StatusOK || len(bookmarks) != 1 {
+		t.Fatalf("get bookmark: status %d, %+v", status, bookmarks)
+	}
+	id := bookmarks[0].Bookmark_ID
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+	}{
+		{"get", "GET", "/bookmark/specific/" + id, nil},
+		{"rename", "PUT", "/bookmark/" + id, map[string]string{"bookmark_name": "mine"}},
+		{"delete", "DELETE", "/bookmark/" + id, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := ts.request(t, tt.method, tt.path, bob, tt.body, nil); status != http.StatusNotFound {
+				t.Errorf("status %d, want 404", status)
+			}
+		})
+	}
+
+	if status := ts.request(t, "GET", "/bookmark", alice, nil, &bookmarks); status != http.StatusOK || len(bookmarks) != 1 || bookmarks[0].Bookmark_Name != "trip" {
+		t.Errorf("bookmark of alice after bob: status %d, %+v", status, bookmarks)
+	}
+}
+
+// failed save does not leave an empty bookmark behind
+func TestCreateAndSaveBookmarkRollback(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signUp(t, "Alice", "alice@example.com")
+
+	req := map[string]string{"bookmark_name": "trip", "destination_id": uuid.New().String()}
+	if status := ts.request(t, "POST", "/bookmark/create-and-save", token, req, nil); status != http.StatusUnprocessableEntity {
+		t.Fatalf("create and save unknown destination: status %d, want 422", status)
+	}
+
+	var bookmarks []*BookmarkType
+	if status := ts.request(t, "GET", "/bookmark", token, nil, &bookmarks); status != http.StatusOK || len(bookmarks) != 0 {
+		t.Fatalf("bookmark after failed save: status %d, %+v", status, bookmarks)
+	}
+}
+
+// destination without image get null cover, or the default image if it is configured
+func TestDestinationCoverImage(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signUp(t, "Alice", "alice@example.com")
+	_, withImage, withoutImage, cover := mustMixedCity(t, ts.store)
+
+	covers := func() map[string]*string {
+		t.Helper()
+
+		var res SendAllDestinationType
+		if status := ts.request(t, "GET", "/destination/Bandung", token, nil, &res); status != http.StatusOK {
+			t.Fatalf("get destination: status %d", status)
+		}
+
+		covers := map[string]*string{}
+		for _, d := range res.List_Destination {
+			covers[d.Destination_ID] = d.Image_URL
+		}
+
+		return covers
+	}
+
+	got := covers()
+	if got[withImage.Destination_ID] == nil || *got[withImage.Destination_ID] != cover {
+		t.Errorf("cover of destination with image = %v, want %s", got[withImage.Destination_ID], cover)
+	}
+	if got[withoutImage.Destination_ID] != nil {
+		t.Errorf("cover of destination without image = %s, want null", *got[withoutImage.Destination_ID])
+	}
+
+	ts.api.config.Default_Image_URL = "https://img.example.com/default.jpg"
+
+	got = covers()
+	if got[withImage.Destination_ID] == nil || *got[withImage.Destination_ID] != cover {
+		t.Errorf("cover of destination with image = %v, want %s", got[withImage.Destination_ID], cover)
+	}
+	if got[withoutImage.Destination_ID] == nil || *got[withoutImage.Destination_ID] != ts.api.config.Default_Image_URL {
+		t.Errorf("cover of destination without image = %v, want default image", got[withoutImage.Destination_ID])
+	}
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// registered email on sign up is a conflict, or a sign in link when Signup_Existing_Send_Signin is on
+func TestSignUpExistingEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		sendLink bool
+		status   int
+		emails   int
+	}{
+		{"conflict", false, http.StatusConflict, 1},
+		{"send sign in link", true, http.StatusOK, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.api.config.Signup_Existing_Send_Signin = tt.sendLink
+
+			if status := ts.request(t, "POST", "/signup", "", map[string]string{"user_name": "Carol", "email": "carol@example.com"}, nil); status != http.StatusOK {
+				t.Fatalf("signup: status %d", status)
+			}
+
+			var res map[string]string
+			if status := ts.request(t, "POST", "/signup", "", map[string]string{"user_name": "Other", "email": "Carol@Example.com"}, &res); status != tt.status {
+				t.Fatalf("signup again: status %d, want %d: %v", status, tt.status, res)
+			}
+
+			messages := ts.mailer.Messages()
+			if len(messages) != tt.emails {
+				t.Fatalf("got %d email, want %d", len(messages), tt.emails)
+			}
+
+			// the link sign in the registered account, the name is not changed
+			last := messages[len(messages)-1]
+			if last.To != "carol@example.com" || last.To_Name != "Carol" {
+				t.Errorf("email sent to %q <%s>", last.To_Name, last.To)
+			}
+
+			if tt.sendLink {
+				if status := ts.request(t, "GET", "/auth/"+linkToken(t, last), "", nil, nil); status != http.StatusOK {
+					t.Errorf("verify link: status %d", status)
+				}
+			}
+		})
+	}
+}
+
+func TestSignUpAndSignInSendMagicLink(t *testing.T) {
+	ts := newTestServer(t)
+
+	const email = "carol@example.com"
+
+	if status := ts.request(t, "POST", "/signup", "", map[string]string{"user_name": "Carol", "email": email}, nil); status != http.StatusOK {
+		t.Fatalf("signup: status %d", status)
+	}
+
+	var known, unknown map[string]string
+	if status := ts.request(t, "POST", "/signin", "", map[string]string{"email": "Carol@Example.com"}, &known); status != http.StatusOK {
+		t.Fatalf("signin: status %d", status)
+	}
+
+	// unknown email get the same response but no email
+	if status := ts.request(t, "POST", "/signin", "", map[string]string{"email": "nobody@example.com"}, &unknown); status != http.StatusOK {
+		t.Fatalf("signin unknown email: status %d, want 200", status)
+	}
+
+	if !reflect.DeepEqual(known, unknown) {
+		t.Errorf("unknown email response %v differ from %v", unknown, known)
+	}
+
+	if _, ok := ts.mailer.LastMessage("nobody@example.com"); ok {
+		t.Error("email sent to unknown address")
+	}
+
+	messages := ts.mailer.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("got %d email, want 2", len(messages))
+	}
+
+	last, ok := ts.mailer.LastMessage(email)
+	if !ok || last != messages[1] {
+		t.Fatalf("LastMessage(%s) is not the sign in email", email)
+	}
+
+	if messages[0].Link == messages[1].Link {
+		t.Error("sign up and sign in got the same link")
+	}
+
+	for _, msg := range messages {
+		if msg.To != email || msg.To_Name != "Carol" {
+			t.Errorf("email sent to %q <%s>", msg.To_Name, msg.To)
+		}
+
+		if !strings.HasPrefix(msg.Link, ts.api.config.App_URL+"/auth/") {
+			t.Errorf("link %q is not under app url", msg.Link)
+		}
+
+		if !strings.Contains(msg.HTML_Body, msg.Link) || !strings.Contains(msg.Text_Body, msg.Link) {
+			t.Error("body does not contain the link")
+		}
+	}
+
+	// both link can be exchanged once
+	for _, msg := range messages {
+		if status := ts.request(t, "GET", "/auth/"+linkToken(t, msg), "", nil, nil); status != http.StatusOK {
+			t.Errorf("verify link: status %d", status)
+		}
+	}
+}
+
+// magic link token signed with its own expiry, the stored nonce can expire before it
+func magicLinkToken(t *testing.T, s Storage, user_id string, nonceExpiry, tokenExpiry time.Duration) string {
+	t.Helper()
+
+	link := &MagicLinkType{Nonce: uuid.New().String(), User_ID: user_id, Expires_At: time.Now().Add(nonceExpiry).Unix()}
+	if err := s.SaveMagicLink(link); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signJWT(&ClaimsType{
+		User_ID:    user_id,
+		Token_Type: tokenTypeMagicLink,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        link.Nonce,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExpiry)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestVerifySignIn(t *testing.T) {
+	ts := newTestServer(t)
+	access := ts.signUp(t, "Alice", "alice@example.com")
+
+	acc, err := ts.store.CheckEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		reuse  bool
+	}{
+		{"valid link", magicLinkToken(t, ts.store, acc.User_ID, time.Minute, time.Minute), http.StatusOK, true},
+		{"expired nonce", magicLinkToken(t, ts.store, acc.User_ID, -time.Minute, time.Minute), http.StatusUnauthorized, false},
+		{"expired token", magicLinkToken(t, ts.store, acc.User_ID, time.Minute, -time.Minute), http.StatusUnauthorized, false},
+		{"unknown nonce", magicLinkToken(t, NewMemoryStore(), acc.User_ID, time.Minute, time.Minute), http.StatusUnauthorized, false},
+		{"session token", access, http.StatusUnauthorized, false},
+		{"garbage", "not-a-token", http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res map[string]any
+			if status := ts.request(t, "GET", "/auth/"+tt.token, "", nil, &res); status != tt.status {
+				t.Fatalf("status %d, want %d: %v", status, tt.status, res)
+			}
+
+			if token, _ := res["token"].(string); tt.status == http.StatusOK && token == "" {
+				t.Fatal("no session token")
+			}
+
+			// link is single use
+			if tt.reuse {
+				if status := ts.request(t, "GET", "/auth/"+tt.token, "", nil, nil); status != http.StatusUnauthorized {
+					t.Fatalf("second use: status %d, want 401", status)
+				}
+			}
+		})
+	}
+}
+
+// only one of the requests using the same link at once get a session
+func TestVerifySignInConcurrent(t *testing.T) {
+	ts := newTestServer(t)
+	acc := mustSignUp(t, ts.store, "Alice", "alice@example.com")
+	token := magicLinkToken(t, ts.store, acc.User_ID, time.Minute, time.Minute)
+
+	const requests = 10
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	statuses := map[int]int{}
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			status, err := ts.send("GET", "/auth/"+token, "", nil, nil)
+			if err != nil {
+				t.Error(err)
+			}
+
+			mu.Lock()
+			statuses[status]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusUnauthorized] != requests-1 {
+		t.Errorf("got statuses %v, want one 200 and %d 401", statuses, requests-1)
+	}
+}
+
+// request authenticated by cookie must repeat the csrf cookie in X-CSRF-Token
+func TestCookieModeCSRF(t *testing.T) {
+	ts := newTestServer(t)
+
+	// bearer token is signed in before cookie mode is on, it is still accepted after
+	access := ts.signUp(t, "Bob", "bob@example.com")
+
+	ts.api.config.Auth_Cookie.Enabled = true
+
+	acc := mustSignUp(t, ts.store, "Alice", "alice@example.com")
+
+	res, err := ts.Client().Get(ts.URL + "/auth/" + magicLinkToken(t, ts.store, acc.User_ID, time.Minute, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var body map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := body["token"]; ok {
+		t.Error("access token is in the body in cookie mode")
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range res.Cookies() {
+		cookies[c.Name] = c
+	}
+
+	csrf, _ := body["csrf_token"].(string)
+	if csrf == "" || cookies[csrfTokenCookie] == nil || cookies[csrfTokenCookie].Value != csrf {
+		t.Fatalf("csrf token %q does not match cookie %v", csrf, cookies[csrfTokenCookie])
+	}
+
+	send := func(method, path, header string, names ...string) int {
+		t.Helper()
+
+		var body io.Reader
+		if path == "/bookmark" {
+			body = strings.NewReader(`{"bookmark_name":"trip"}`)
+		}
+
+		req, err := http.NewRequest(method, ts.URL+path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range names {
+			req.AddCookie(cookies[name])
+		}
+
+		if header != "" {
+			req.Header.Set(csrfHeader, header)
+		}
+
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		header  string
+		cookies []string
+		status  int
+	}{
+		{"safe method without header", "GET", "/bookmark", "", []string{accessTokenCookie}, http.StatusOK},
+		{"no csrf cookie and header", "POST", "/bookmark", "", []string{accessTokenCookie}, http.StatusForbidden},
+		{"no header", "POST", "/bookmark", "", []string{accessTokenCookie, csrfTokenCookie}, http.StatusForbidden},
+		{"wrong header", "POST", "/bookmark", "wrong", []string{accessTokenCookie, csrfTokenCookie}, http.StatusForbidden},
+		{"header without cookie", "POST", "/bookmark", csrf, []string{accessTokenCookie}, http.StatusForbidden},
+		{"matching header", "POST", "/bookmark", csrf, []string{accessTokenCookie, csrfTokenCookie}, http.StatusOK},
+		{"refresh without header", "POST", "/auth/refresh", "", []string{refreshTokenCookie, csrfTokenCookie}, http.StatusForbidden},
+		{"refresh with header", "POST", "/auth/refresh", csrf, []string{refreshTokenCookie, csrfTokenCookie}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := send(tt.method, tt.path, tt.header, tt.cookies...); status != tt.status {
+				t.Errorf("status %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	// frontend can read the csrf token again after reload
+	req, _ := http.NewRequest("GET", ts.URL+"/auth/csrf", nil)
+	req.AddCookie(cookies[csrfTokenCookie])
+
+	res, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var got map[string]string
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil || got["csrf_token"] != csrf {
+		t.Errorf("get csrf token: %v, %v", got, err)
+	}
+
+	// bearer header is not sent by the browser on its own, csrf is not needed
+	if status := ts.request(t, "POST", "/bookmark", access, map[string]string{"bookmark_name": "trip"}, nil); status != http.StatusOK {
+		t.Errorf("bearer request: status %d, want 200", status)
+	}
+}
+
+// reuse of a rotated refresh token revoke every token of the session
+func TestRefreshTokenReuse(t *testing.T) {
+	ts := newTestServer(t)
+	acc := mustSignUp(t, ts.store, "Alice", "alice@example.com")
+
+	var first map[string]any
+	if status := ts.request(t, "GET", "/auth/"+magicLinkToken(t, ts.store, acc.User_ID, time.Minute, time.Minute), "", nil, &first); status != http.StatusOK {
+		t.Fatalf("verify sign in: status %d", status)
+	}
+
+	var second map[string]any
+	if status := ts.request(t, "POST", "/auth/refresh", "", map[string]any{"refresh_token": first["refresh_token"]}, &second); status != http.StatusOK {
+		t.Fatalf("refresh: status %d", status)
+	}
+
+	access, _ := second["token"].(string)
+	if status := ts.request(t, "GET", "/bookmark", access, nil, nil); status != http.StatusOK {
+		t.Fatalf("rotated access token: status %d", status)
+	}
+
+	if status := ts.request(t, "POST", "/auth/refresh", "", map[string]any{"refresh_token": first["refresh_token"]}, nil); status != http.StatusUnauthorized {
+		t.Fatalf("reuse rotated refresh token: status %d, want 401", status)
+	}
+
+	// the newest token of the family is revoked too
+	if status := ts.request(t, "POST", "/auth/refresh", "", map[string]any{"refresh_token": second["refresh_token"]}, nil); status != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse: status %d, want 401", status)
+	}
+
+	if status := ts.request(t, "GET", "/bookmark", access, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("access token after reuse: status %d, want 401", status)
+	}
+}
+
+// empty refresh body with unknown length, sent chunked, is the same as no body
+func TestRefreshTokenBody(t *testing.T) {
+	ts := newTestServer(t)
+	acc := mustSignUp(t, ts.store, "Alice", "alice@example.com")
+
+	var tokens map[string]any
+	if status := ts.request(t, "GET", "/auth/"+magicLinkToken(t, ts.store, acc.User_ID, time.Minute, time.Minute), "", nil, &tokens); status != http.StatusOK {
+		t.Fatalf("verify sign in: status %d", status)
+	}
+	refresh, _ := tokens["refresh_token"].(string)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"empty", "", http.StatusUnauthorized},
+		{"invalid json", "{", http.StatusBadRequest},
+		{"unknown field", `{"token":"x"}`, http.StatusBadRequest},
+		{"refresh token", `{"refresh_token":"` + refresh + `"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", ts.URL+"/auth/refresh", io.NopCloser(strings.NewReader(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.TransferEncoding = []string{"chunked"}
+
+			res, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t)
+	access := ts.signUp(t, "Alice", "alice@example.com")
+
+	// second session of the same user by sign in again
+	if status := ts.request(t, "POST", "/signin", "", map[string]string{"email": "alice@example.com"}, nil); status != http.StatusOK {
+		t.Fatalf("signin: status %d", status)
+	}
+
+	msg, _ := ts.mailer.LastMessage("alice@example.com")
+
+	var res map[string]any
+	if status := ts.request(t, "GET", "/auth/"+linkToken(t, msg), "", nil, &res); status != http.StatusOK {
+		t.Fatalf("verify link: status %d", status)
+	}
+	other, _ := res["token"].(string)
+
+	// logout change state so it is not a GET
+	if status := ts.request(t, "GET", "/logout", access, nil, nil); status != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /logout: status %d, want 405", status)
+	}
+
+	if status := ts.request(t, "POST", "/logout", access, nil, nil); status != http.StatusOK {
+		t.Fatalf("logout: status %d", status)
+	}
+
+	if status := ts.request(t, "GET", "/bookmark", access, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("logged out token: status %d, want 401", status)
+	}
+
+	// other session of the same user is kept
+	if status := ts.request(t, "GET", "/bookmark", other, nil, nil); status != http.StatusOK {
+		t.Errorf("other session: status %d, want 200", status)
+	}
+}
+
+// user list and revoke their own session, session of other user is not found
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t)
+	access := ts.signUp(t, "Alice", "alice@example.com")
+	bob := ts.signUp(t, "Bob", "bob@example.com")
+
+	// second session of alice by sign in again
+	if status := ts.request(t, "POST", "/signin", "", map[string]string{"email": "alice@example.com"}, nil); status != http.StatusOK {
+		t.Fatalf("signin: status %d", status)
+	}
+
+	msg, _ := ts.mailer.LastMessage("alice@example.com")
+
+	var res map[string]any
+	if status := ts.request(t, "GET", "/auth/"+linkToken(t, msg), "", nil, &res); status != http.StatusOK {
+		t.Fatalf("verify link: status %d", status)
+	}
+	other, _ := res["token"].(string)
+
+	sessions := func(token string) []*SessionType {
+		t.Helper()
+
+		var list []*SessionType
+		if status := ts.request(t, "GET", "/sessions", token, nil, &list); status != http.StatusOK {
+			t.Fatalf("get sessions: status %d", status)
+		}
+
+		return list
+	}
+
+	list := sessions(access)
+	if len(list) != 2 {
+		t.Fatalf("got %d session, want 2", len(list))
+	}
+
+	var current, otherID string
+	for _, sess := range list {
+		if sess.Current {
+			current = sess.Session_ID
+		} else {
+			otherID = sess.Session_ID
+		}
+	}
+
+	if current == "" || otherID == "" {
+		t.Fatalf("want one current session, got %+v", list)
+	}
+
+	bobList := sessions(bob)
+	if len(bobList) != 1 {
+		t.Fatalf("bob got %d session, want 1", len(bobList))
+	}
+
+	// session of other user is not found
+	if status := ts.request(t, "DELETE", "/sessions/"+bobList[0].Session_ID, access, nil, nil); status != http.StatusNotFound {
+		t.Errorf("delete session of other user: status %d, want 404", status)
+	}
+
+	if status := ts.request(t, "GET", "/bookmark", bob, nil, nil); status != http.StatusOK {
+		t.Errorf("bob after delete by alice: status %d, want 200", status)
+	}
+
+	// revoke other session of alice
+	if status := ts.request(t, "DELETE", "/sessions/"+otherID, access, nil, nil); status != http.StatusOK {
+		t.Fatalf("delete own session: status %d", status)
+	}
+
+	if status := ts.request(t, "GET", "/bookmark", other, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d, want 401", status)
+	}
+
+	if list := sessions(access); len(list) != 1 || list[0].Session_ID != current {
+		t.Errorf("sessions after revoke: %+v", list)
+	}
+
+	// revoked session is not found again
+	if status := ts.request(t, "DELETE", "/sessions/"+otherID, access, nil, nil); status != http.StatusNotFound {
+		t.Errorf("delete revoked session: status %d, want 404", status)
+	}
+
+	// revoke current session
+	if status := ts.request(t, "DELETE", "/sessions/"+current, access, nil, nil); status != http.StatusOK {
+		t.Fatalf("delete current session: status %d", status)
+	}
+
+	if status := ts.request(t, "GET", "/sessions", access, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("current session after revoke: status %d, want 401", status)
+	}
+}
+
+func TestCleanupExpiredTokensStop(t *testing.T) {
+	ts := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		ts.api.cleanupExpiredTokens(ctx, time.Hour)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup does not stop when ctx is done")
+	}
+}
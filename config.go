@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting of the server, read from YAML file in CONFIG_FILE then env var,
+// env var always win over the file
+type Config struct {
+	Port              string         `yaml:"port"`              // PORT
+	App_URL           string         `yaml:"app_url"`           // APP_URL, frontend url used in sign in link
+	Allowed_Origins   []string       `yaml:"allowed_origins"`   // ALLOWED_ORIGINS, comma separated
+	Default_Image_URL string         `yaml:"default_image_url"` // DEFAULT_IMAGE_URL, cover of destination without image
+	Trusted_Proxies   []string       `yaml:"trusted_proxies"`   // TRUSTED_PROXIES, comma separated ip or cidr
+	Database          DatabaseConfig `yaml:"database"`
+	Mail              MailConfig     `yaml:"mail"`
+	JWT               JWTConfig      `yaml:"jwt"`
+	Auth_Cookie       CookieConfig   `yaml:"auth_cookie"`
+
+	// sign up with registered email send sign in link instead of conflict error,
+	// so the response does not tell if the email is registered
+	Signup_Existing_Send_Signin bool `yaml:"signup_existing_send_signin"` // SIGNUP_EXISTING_SEND_SIGNIN
+}
+
+type DatabaseConfig struct {
+	Driver string `yaml:"driver"` // STORAGE_DRIVER, mysql, sqlite, postgres or memory, empty use DSN scheme
+	DSN    string `yaml:"dsn"`    // DSN
+}
+
+type MailConfig struct {
+	Mailer       string        `yaml:"mailer"`       // MAILER, smtp, file or memory
+	Dir          string        `yaml:"dir"`          // MAIL_DIR, directory of file mailer
+	Template_Dir string        `yaml:"template_dir"` // EMAIL_TEMPLATE_DIR, file here replace the embedded email template
+	Max_Attempts int           `yaml:"max_attempts"` // MAIL_MAX_ATTEMPTS, attempts before email is dead
+	Retry_Delay  time.Duration `yaml:"retry_delay"`  // MAIL_RETRY_DELAY, delay after the first failure, doubled every attempt
+	SMTP         SMTPConfig    `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`     // SMTP_HOST
+	Port     int    `yaml:"port"`     // SMTP_PORT
+	TLS      string `yaml:"tls"`      // SMTP_TLS, empty for STARTTLS, ssl or insecure
+	Username string `yaml:"username"` // EMAIL, also the sender address
+	Password string `yaml:"password"` // PASSWORD_EMAIL
+}
+
+// send token as HttpOnly cookie instead of json body
+type CookieConfig struct {
+	Enabled   bool   `yaml:"enabled"`   // AUTH_COOKIE
+	Same_Site string `yaml:"same_site"` // AUTH_COOKIE_SAME_SITE, none, lax or strict
+}
+
+// lax and strict only work when frontend and api are on the same site
+func (c CookieConfig) SameSite() http.SameSite {
+	switch c.Same_Site {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	default:
+		return http.SameSiteNoneMode
+	}
+}
+
+type JWTConfig struct {
+	Alg               string            `yaml:"alg"`               // JWT_ALG, HS256, RS256 or EdDSA
+	Kid               string            `yaml:"kid"`               // JWT_KID
+	Secret            string            `yaml:"secret"`            // JWT_SECRET
+	Private_Key_File  string            `yaml:"private_key_file"`  // JWT_PRIVATE_KEY_FILE
+	Previous_Secrets  map[string]string `yaml:"previous_secrets"`  // JWT_PREVIOUS_SECRETS, "kid=secret,kid=secret"
+	Verify_Keys       map[string]string `yaml:"verify_keys"`       // JWT_VERIFY_KEYS, "kid=path,kid=path"
+	Access_Token_TTL  time.Duration     `yaml:"access_token_ttl"`  // ACCESS_TOKEN_TTL
+	Refresh_Token_TTL time.Duration     `yaml:"refresh_token_ttl"` // REFRESH_TOKEN_TTL
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Port:    "8000",
+		App_URL: "https://roadtrip-laannen-gmailcom.vercel.app",
+		// only exact origin, credentials are sent so a wildcard is left for the operator to add
+		Allowed_Origins: []string{
+			"https://roadtrip.vercel.app",
+			"https://roadtrip-laannen-gmailcom.vercel.app",
+		},
+		Mail: MailConfig{
+			Mailer:       "smtp",
+			Dir:          "mail",
+			Max_Attempts: 8,
+			Retry_Delay:  30 * time.Second,
+			SMTP:         SMTPConfig{Host: "smtp.gmail.com", Port: 587},
+		},
+		JWT: JWTConfig{
+			Alg:               "HS256",
+			Kid:               "default",
+			Access_Token_TTL:  15 * time.Minute,
+			Refresh_Token_TTL: 30 * 24 * time.Hour,
+		},
+		Auth_Cookie: CookieConfig{Same_Site: "none"},
+	}
+}
+
+// load default, then YAML file in CONFIG_FILE, then env var, and validate the result
+func LoadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	cfg.normalize()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadEnv() error {
+	setString := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+
+	setString("PORT", &c.Port)
+	setString("APP_URL", &c.App_URL)
+	setString("DEFAULT_IMAGE_URL", &c.Default_Image_URL)
+	setString("STORAGE_DRIVER", &c.Database.Driver)
+	setString("DSN", &c.Database.DSN)
+	setString("MAILER", &c.Mail.Mailer)
+	setString("MAIL_DIR", &c.Mail.Dir)
+	setString("EMAIL_TEMPLATE_DIR", &c.Mail.Template_Dir)
+	setString("SMTP_HOST", &c.Mail.SMTP.Host)
+	setString("SMTP_TLS", &c.Mail.SMTP.TLS)
+	setString("EMAIL", &c.Mail.SMTP.Username)
+	setString("PASSWORD_EMAIL", &c.Mail.SMTP.Password)
+	setString("JWT_ALG", &c.JWT.Alg)
+	setString("JWT_KID", &c.JWT.Kid)
+	setString("JWT_SECRET", &c.JWT.Secret)
+	setString("JWT_PRIVATE_KEY_FILE", &c.JWT.Private_Key_File)
+	setString("AUTH_COOKIE_SAME_SITE", &c.Auth_Cookie.Same_Site)
+
+	if v := os.Getenv("ALLOWED_ORIGINS"); v != "" {
+		c.Allowed_Origins = strings.Split(v, ",")
+	}
+
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		c.Trusted_Proxies = strings.Split(v, ",")
+	}
+
+	ints := map[string]*int{
+		"SMTP_PORT":         &c.Mail.SMTP.Port,
+		"MAIL_MAX_ATTEMPTS": &c.Mail.Max_Attempts,
+	}
+
+	for key, dst := range ints {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %s invalid", key, v)
+			}
+			*dst = n
+		}
+	}
+
+	bools := map[string]*bool{
+		"AUTH_COOKIE":                 &c.Auth_Cookie.Enabled,
+		"SIGNUP_EXISTING_SEND_SIGNIN": &c.Signup_Existing_Send_Signin,
+	}
+
+	for key, dst := range bools {
+		if v := os.Getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s: %s invalid", key, v)
+			}
+			*dst = b
+		}
+	}
+
+	if v := os.Getenv("JWT_PREVIOUS_SECRETS"); v != "" {
+		c.JWT.Previous_Secrets = parseKeyList(v)
+	}
+
+	if v := os.Getenv("JWT_VERIFY_KEYS"); v != "" {
+		c.JWT.Verify_Keys = parseKeyList(v)
+	}
+
+	durations := map[string]*time.Duration{
+		"ACCESS_TOKEN_TTL":  &c.JWT.Access_Token_TTL,
+		"REFRESH_TOKEN_TTL": &c.JWT.Refresh_Token_TTL,
+		"MAIL_RETRY_DELAY":  &c.Mail.Retry_Delay,
+	}
+
+	for key, dst := range durations {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %s invalid", key, v)
+			}
+			*dst = d
+		}
+	}
+
+	return nil
+}
+
+// driver taken from DSN scheme if not set, trim trailing slash of url
+func (c *Config) normalize() {
+	if c.Database.Driver == "" {
+		switch dsn := c.Database.DSN; {
+		case strings.HasPrefix(dsn, "sqlite://"):
+			c.Database.Driver = "sqlite"
+		case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+			c.Database.Driver = "postgres"
+		default:
+			c.Database.Driver = "mysql"
+		}
+	}
+
+	c.App_URL = strings.TrimRight(strings.TrimSpace(c.App_URL), "/")
+	c.Default_Image_URL = strings.TrimSpace(c.Default_Image_URL)
+	c.Auth_Cookie.Same_Site = strings.ToLower(strings.TrimSpace(c.Auth_Cookie.Same_Site))
+
+	origins := []string{}
+	for _, origin := range c.Allowed_Origins {
+		// origin header never has trailing slash
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, strings.ToLower(origin))
+		}
+	}
+	c.Allowed_Origins = origins
+
+	proxies := []string{}
+	for _, proxy := range c.Trusted_Proxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	c.Trusted_Proxies = proxies
+}
+
+// check every setting, all problem are returned at once
+func (c *Config) Validate() error {
+	errs := []error{}
+	check := func(ok bool, format string, a ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "port: %s invalid", c.Port)
+
+	appURL, err := url.Parse(c.App_URL)
+	check(err == nil && (appURL.Scheme == "https" || appURL.Scheme == "http") && appURL.Host != "", "app_url: %s must be an absolute http(s) url", c.App_URL)
+
+	if c.Default_Image_URL != "" {
+		imageURL, err := url.Parse(c.Default_Image_URL)
+		check(err == nil && (imageURL.Scheme == "https" || imageURL.Scheme == "http") && imageURL.Host != "", "default_image_url: %s must be an absolute http(s) url", c.Default_Image_URL)
+	}
+
+	for _, origin := range c.Allowed_Origins {
+		check(validOrigin(origin), "allowed_origins: %s must be scheme://host[:port], * only allowed inside the host", origin)
+	}
+
+	for _, proxy := range c.Trusted_Proxies {
+		_, err := parseProxy(proxy)
+		check(err == nil, "trusted_proxies: %s must be an ip or cidr", proxy)
+	}
+
+	switch c.Database.Driver {
+	case "mysql", "sqlite", "postgres":
+		check(c.Database.Driver == "sqlite" || c.Database.DSN != "", "database.dsn: required for %s", c.Database.Driver)
+	case "memory":
+	default:
+		check(false, "database.driver: %s not supported", c.Database.Driver)
+	}
+
+	switch c.Mail.Mailer {
+	case "smtp":
+		check(c.Mail.SMTP.Host != "", "mail.smtp.host: required")
+		check(c.Mail.SMTP.Port > 0 && c.Mail.SMTP.Port < 65536, "mail.smtp.port: %d invalid", c.Mail.SMTP.Port)
+		check(c.Mail.SMTP.TLS == "" || c.Mail.SMTP.TLS == "ssl" || c.Mail.SMTP.TLS == "insecure", "mail.smtp.tls: %s not supported", c.Mail.SMTP.TLS)
+	case "file", "memory":
+	default:
+		check(false, "mail.mailer: %s not supported", c.Mail.Mailer)
+	}
+
+	check(c.Mail.Max_Attempts > 0, "mail.max_attempts: must be positive")
+	check(c.Mail.Retry_Delay > 0, "mail.retry_delay: must be positive")
+
+	if c.Mail.Template_Dir != "" {
+		info, err := os.Stat(c.Mail.Template_Dir)
+		check(err == nil && info.IsDir(), "mail.template_dir: %s must be a directory", c.Mail.Template_Dir)
+	}
+
+	switch c.Auth_Cookie.Same_Site {
+	case "none", "lax", "strict":
+	default:
+		check(false, "auth_cookie.same_site: %s not supported", c.Auth_Cookie.Same_Site)
+	}
+
+	switch c.JWT.Alg {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		check(false, "jwt.alg: %s not supported", c.JWT.Alg)
+	}
+
+	check(c.JWT.Kid != "", "jwt.kid: required")
+	check(c.JWT.Access_Token_TTL > 0, "jwt.access_token_ttl: must be positive")
+	check(c.JWT.Refresh_Token_TTL > c.JWT.Access_Token_TTL, "jwt.refresh_token_ttl: must be longer than access_token_ttl")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// origin is scheme://host[:port], one "*" can replace part of a host label.
+// allow every origin is not supported because credentials are allowed
+func validOrigin(origin string) bool {
+	if strings.Count(origin, "*") > 1 {
+		return false
+	}
+
+	u, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	if err != nil {
+		return false
+	}
+
+	if strings.Contains(origin, "*") && !strings.Contains(u.Hostname(), "wildcard") {
+		return false
+	}
+
+	return (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+// proxy is an ip or a cidr
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// parsed trusted_proxies, invalid entry is already rejected by Validate
+func (c *Config) TrustedProxies() []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, proxy := range c.Trusted_Proxies {
+		if prefix, err := parseProxy(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes
+}
+
+// used as cors AllowOriginFunc, "*" in a pattern only match inside one host label
+// so "https://app-*.vercel.app" does not match "https://app-x.evil.com/.vercel.app"
+func (c *Config) AllowOrigin(r *http.Request, origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, allowed := range c.Allowed_Origins {
+		if allowed == origin {
+			return true
+		}
+
+		prefix, suffix, ok := strings.Cut(allowed, "*")
+		if !ok || len(origin) < len(prefix)+len(suffix) {
+			continue
+		}
+
+		if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+			continue
+		}
+
+		middle := origin[len(prefix) : len(origin)-len(suffix)]
+		if middle != "" && !strings.ContainsAny(middle, "./:@") {
+			return true
+		}
+	}
+
+	return false
+}
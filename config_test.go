@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// example file must stay loadable and match the default
+func TestLoadConfigExample(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "config.example.yaml")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := defaultConfig()
+	if !reflect.DeepEqual(cfg.Allowed_Origins, def.Allowed_Origins) {
+		t.Errorf("example allowed origins %v, default %v", cfg.Allowed_Origins, def.Allowed_Origins)
+	}
+
+	if cfg.Mail.Max_Attempts != def.Mail.Max_Attempts || cfg.Mail.Retry_Delay != def.Mail.Retry_Delay || cfg.Auth_Cookie != def.Auth_Cookie || cfg.Signup_Existing_Send_Signin {
+		t.Errorf("example differ from default: mail %+v, auth_cookie %+v", cfg.Mail, cfg.Auth_Cookie)
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("STORAGE_DRIVER", "memory")
+	t.Setenv("AUTH_COOKIE", "true")
+	t.Setenv("AUTH_COOKIE_SAME_SITE", "Lax")
+	t.Setenv("SIGNUP_EXISTING_SEND_SIGNIN", "1")
+	t.Setenv("EMAIL_TEMPLATE_DIR", dir)
+	t.Setenv("MAIL_MAX_ATTEMPTS", "3")
+	t.Setenv("MAIL_RETRY_DELAY", "1m")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.Auth_Cookie.Enabled || cfg.Auth_Cookie.SameSite() != http.SameSiteLaxMode {
+		t.Errorf("auth_cookie %+v", cfg.Auth_Cookie)
+	}
+
+	if !cfg.Signup_Existing_Send_Signin {
+		t.Error("signup_existing_send_signin not set")
+	}
+
+	if cfg.Mail.Template_Dir != dir || cfg.Mail.Max_Attempts != 3 || cfg.Mail.Retry_Delay != time.Minute {
+		t.Errorf("mail %+v", cfg.Mail)
+	}
+}
+
+func TestLoadConfigInvalidEnv(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		err   string
+	}{
+		{"AUTH_COOKIE", "yes please", "AUTH_COOKIE"},
+		{"AUTH_COOKIE_SAME_SITE", "always", "auth_cookie.same_site"},
+		{"SIGNUP_EXISTING_SEND_SIGNIN", "maybe", "SIGNUP_EXISTING_SEND_SIGNIN"},
+		{"EMAIL_TEMPLATE_DIR", "/does/not/exist", "mail.template_dir"},
+		{"MAIL_MAX_ATTEMPTS", "many", "MAIL_MAX_ATTEMPTS"},
+		{"MAIL_MAX_ATTEMPTS", "0", "mail.max_attempts"},
+		{"MAIL_RETRY_DELAY", "soon", "MAIL_RETRY_DELAY"},
+		{"MAIL_RETRY_DELAY", "-1s", "mail.retry_delay"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv("STORAGE_DRIVER", "memory")
+			t.Setenv(tt.key, tt.value)
+
+			_, err := LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// default only allow exact origin, wildcard added by operator match one host label
+func TestAllowOrigin(t *testing.T) {
+	def := defaultConfig()
+
+	for _, origin := range def.Allowed_Origins {
+		if strings.Contains(origin, "*") {
+			t.Errorf("default allowed origin %s has a wildcard", origin)
+		}
+	}
+
+	withWildcard := defaultConfig()
+	withWildcard.Allowed_Origins = append(withWildcard.Allowed_Origins, "https://roadtrip-*-laannen-gmailcom.vercel.app")
+
+	tests := []struct {
+		name   string
+		cfg    *Config
+		origin string
+		want   bool
+	}{
+		{"exact", def, "https://roadtrip.vercel.app", true},
+		{"exact is case insensitive", def, "https://RoadTrip.vercel.app", true},
+		{"preview without wildcard", def, "https://roadtrip-git-main-laannen-gmailcom.vercel.app", false},
+		{"other origin", def, "https://evil.example.com", false},
+		{"http scheme", def, "http://roadtrip.vercel.app", false},
+		{"preview with wildcard", withWildcard, "https://roadtrip-git-main-laannen-gmailcom.vercel.app", true},
+		{"wildcard match empty label", withWildcard, "https://roadtrip--laannen-gmailcom.vercel.app", false},
+		{"wildcard across label", withWildcard, "https://roadtrip-x.evil.com/-laannen-gmailcom.vercel.app", false},
+		{"wildcard with other host", withWildcard, "https://roadtrip-x.evil-laannen-gmailcom.vercel.app", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.AllowOrigin(nil, tt.origin); got != tt.want {
+				t.Errorf("AllowOrigin(%s) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
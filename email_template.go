@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/email
+var emailTemplateFS embed.FS
+
+// first locale is the default
+var supportedLocales = []string{"en", "id"}
+
+// every email, each locale has <name>.html and <name>.txt
+var emailTemplateNames = []string{"signin"}
+
+const appName = "RoadTrip"
+
+// data of every email template
+type EmailData struct {
+	Locale     string
+	App_Name   string
+	Subject    string
+	User_Name  string
+	Link       string
+	Expires_In int
+}
+
+// html part use layout.html with blocks from <locale>/<name>.html and auto escaped,
+// text part and subject come from <locale>/<name>.txt
+type EmailTemplates struct {
+	html map[string]*htmltemplate.Template
+	text map[string]*texttemplate.Template
+}
+
+// parse every template, file in dir replace the embedded one with the same path
+func LoadEmailTemplates(dir string) (*EmailTemplates, error) {
+	base, err := fs.Sub(emailTemplateFS, "templates/email")
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := base
+	if dir != "" {
+		fsys = overlayFS{top: os.DirFS(dir), base: base}
+	}
+
+	t := &EmailTemplates{
+		html: map[string]*htmltemplate.Template{},
+		text: map[string]*texttemplate.Template{},
+	}
+
+	for _, locale := range supportedLocales {
+		for _, name := range emailTemplateNames {
+			key := locale + "/" + name
+
+			html, err := htmltemplate.ParseFS(fsys, "layout.html", key+".html")
+			if err != nil {
+				return nil, fmt.Errorf("email template %s: %w", key, err)
+			}
+
+			text, err := texttemplate.ParseFS(fsys, key+".txt")
+			if err != nil {
+				return nil, fmt.Errorf("email template %s: %w", key, err)
+			}
+
+			if text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("email template %s: subject not defined", key)
+			}
+
+			t.html[key] = html
+			t.text[key] = text
+		}
+	}
+
+	return t, nil
+}
+
+// render subject, html and plain text body of email
+func (t *EmailTemplates) Render(name, locale string, data *EmailData) (*MailType, error) {
+	if !isSupportedLocale(locale) {
+		locale = supportedLocales[0]
+	}
+
+	key := locale + "/" + name
+
+	html, ok := t.html[key]
+	if !ok {
+		return nil, fmt.Errorf("email template %s not found", key)
+	}
+	text := t.text[key]
+
+	data.Locale = locale
+	data.App_Name = appName
+
+	var subject bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	data.Subject = strings.TrimSpace(subject.String())
+
+	var textBody bytes.Buffer
+	if err := text.ExecuteTemplate(&textBody, name+".txt", data); err != nil {
+		return nil, err
+	}
+
+	var htmlBody bytes.Buffer
+	if err := html.ExecuteTemplate(&htmlBody, "layout.html", data); err != nil {
+		return nil, err
+	}
+
+	return &MailType{
+		Subject:   data.Subject,
+		HTML_Body: htmlBody.String(),
+		Text_Body: textBody.String(),
+		Link:      data.Link,
+	}, nil
+}
+
+// open file from top first then from base
+type overlayFS struct {
+	top  fs.FS
+	base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.top.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+
+	return file, err
+}
+
+func isSupportedLocale(locale string) bool {
+	for _, l := range supportedLocales {
+		if l == locale {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pick language of email, user preference first then Accept-Language
+func emailLocale(r *http.Request, account *AccountType) string {
+	if isSupportedLocale(account.Locale) {
+		return account.Locale
+	}
+
+	for _, tag := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		// only the primary subtag matter, "id-ID" is "id"
+		primary, _, _ := strings.Cut(tag, "-")
+		if isSupportedLocale(primary) {
+			return primary
+		}
+	}
+
+	return supportedLocales[0]
+}
+
+// language tags of Accept-Language sorted by q value, highest first
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	langs := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+
+		if q > 0 {
+			langs = append(langs, weighted{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+
+	return tags
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// compare got with testdata/<name>, rewrite the file with -update
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != string(want) {
+		t.Errorf("%s does not match, run go test -run %s -update to see the diff\ngot:\n%s", path, t.Name(), got)
+	}
+}
+
+// user name with markup must be escaped in html and kept as is in plain text
+func TestRenderSignInEmail(t *testing.T) {
+	emails, err := LoadEmailTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, locale := range supportedLocales {
+		t.Run(locale, func(t *testing.T) {
+			msg, err := emails.Render("signin", locale, &EmailData{
+				User_Name:  `<b>Alice</b> & "Bob"`,
+				Link:       "https://app.example.com/auth/abc.def.ghi?a=1&b=2",
+				Expires_In: 15,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(msg.HTML_Body, "<b>Alice</b>") {
+				t.Error("user name is not escaped in html body")
+			}
+
+			golden(t, "email/"+locale+"/signin.subject", msg.Subject+"\n")
+			golden(t, "email/"+locale+"/signin.html", msg.HTML_Body)
+			golden(t, "email/"+locale+"/signin.txt", msg.Text_Body)
+		})
+	}
+}
+
+// unsupported locale fall back to the first one
+func TestRenderUnsupportedLocale(t *testing.T) {
+	emails, err := LoadEmailTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	en, err := emails.Render("signin", "en", &EmailData{User_Name: "Alice", Link: "https://app.example.com/auth/x", Expires_In: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr, err := emails.Render("signin", "fr", &EmailData{User_Name: "Alice", Link: "https://app.example.com/auth/x", Expires_In: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if en.Subject != fr.Subject || en.Text_Body != fr.Text_Body {
+		t.Error("unsupported locale is not rendered in en")
+	}
+}
+
+// file in EMAIL_TEMPLATE_DIR replace only the embedded file with the same path
+func TestEmailTemplateOverride(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "en"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	override := `{{define "subject"}}Custom sign in{{end}}Hi {{.User_Name}}, go to {{.Link}}`
+	if err := os.WriteFile(filepath.Join(dir, "en", "signin.txt"), []byte(override), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	emails, err := LoadEmailTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := func() *EmailData {
+		return &EmailData{User_Name: "Alice", Link: "https://app.example.com/auth/x", Expires_In: 15}
+	}
+
+	en, err := emails.Render("signin", "en", data())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if en.Subject != "Custom sign in" || en.Text_Body != "Hi Alice, go to https://app.example.com/auth/x" {
+		t.Errorf("override not used: %q, %q", en.Subject, en.Text_Body)
+	}
+
+	// html of en and every file of id still come from the embedded templates
+	if !strings.Contains(en.HTML_Body, "https://app.example.com/auth/x") {
+		t.Error("embedded html is not used")
+	}
+
+	embedded, err := LoadEmailTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := embedded.Render("signin", "id", data())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := emails.Render("signin", "id", data())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *got != *want {
+		t.Error("id template changed by en override")
+	}
+
+	// broken override is reported when loading, not when sending
+	if err := os.WriteFile(filepath.Join(dir, "en", "signin.txt"), []byte("no subject"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadEmailTemplates(dir); err == nil {
+		t.Error("template without subject is loaded")
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"id", []string{"id"}},
+		{"en-US,en;q=0.9,id;q=0.8", []string{"en-us", "en", "id"}},
+		{"en;q=0.5, id-ID;q=0.9", []string{"id-id", "en"}},
+		{"fr;q=0.7, ID ;q=0.7", []string{"fr", "id"}},
+		{"*, id;q=0.1", []string{"id"}},
+		{"en;q=0, id", []string{"id"}},
+		{"en;q=abc, id;q=0.3", []string{"id"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := parseAcceptLanguage(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailLocale(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		header string
+		want   string
+	}{
+		{"user preference win", "id", "en-US", "id"},
+		{"accept language", "", "id-ID,en;q=0.5", "id"},
+		{"first supported tag", "", "fr, id;q=0.8, en;q=0.9", "en"},
+		{"unsupported user locale", "fr", "id", "id"},
+		{"nothing supported", "", "fr, de", "en"},
+		{"no header", "", "", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/signin", nil)
+			if tt.header != "" {
+				r.Header.Set("Accept-Language", tt.header)
+			}
+
+			if got := emailLocale(r, &AccountType{Locale: tt.locale}); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
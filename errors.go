@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindBadRequest
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindPayloadTooLarge
+)
+
+// typed error returned by storage and handlers, mapped into http status by WriteError
+type AppError struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  map[string]string
+	Err     error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil && e.Message == "" {
+		return e.Err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AppError) Status() int {
+	switch e.Kind {
+	case KindBadRequest:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindValidation:
+		return http.StatusUnprocessableEntity
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindPayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func BadRequestError(format string, a ...any) *AppError {
+	return &AppError{Kind: KindBadRequest, Code: "bad_request", Message: fmt.Sprintf(format, a...)}
+}
+
+func NotFoundError(format string, a ...any) *AppError {
+	return &AppError{Kind: KindNotFound, Code: "not_found", Message: fmt.Sprintf(format, a...)}
+}
+
+func ConflictError(format string, a ...any) *AppError {
+	return &AppError{Kind: KindConflict, Code: "conflict", Message: fmt.Sprintf(format, a...)}
+}
+
+func ValidationError(fields map[string]string, format string, a ...any) *AppError {
+	return &AppError{Kind: KindValidation, Code: "validation_failed", Message: fmt.Sprintf(format, a...), Fields: fields}
+}
+
+func UnauthorizedError(format string, a ...any) *AppError {
+	return &AppError{Kind: KindUnauthorized, Code: "unauthorized", Message: fmt.Sprintf(format, a...)}
+}
+
+func ForbiddenError(format string, a ...any) *AppError {
+	return &AppError{Kind: KindForbidden, Code: "forbidden", Message: fmt.Sprintf(format, a...)}
+}
+
+func InternalError(err error) *AppError {
+	return &AppError{Kind: KindInternal, Code: "internal", Err: err}
+}
+
+// check kind of error, false if it is not AppError
+func IsErrorKind(err error, kind ErrorKind) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Kind == kind
+}
+
+// write error as json, internal error only logged and not sent to client
+func WriteError(w http.ResponseWriter, err error) error {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		appErr = InternalError(err)
+	}
+
+	if appErr.Kind == KindInternal {
+		log.Println("internal error:", appErr.Err)
+		return WriteJSON(w, http.StatusInternalServerError, ApiError{Error: "internal server error", Code: appErr.Code})
+	}
+
+	if header := wwwAuthenticate(appErr); header != "" {
+		w.Header().Set("WWW-Authenticate", header)
+	}
+
+	return WriteJSON(w, appErr.Status(), ApiError{Error: appErr.Message, Code: appErr.Code, Fields: appErr.Fields})
+}
+
+// WWW-Authenticate header of RFC 6750 for auth error
+func wwwAuthenticate(appErr *AppError) string {
+	const realm = `Bearer realm="roadtrip"`
+
+	// RFC 6750 only allow printable ascii without " and \ in error_description
+	desc := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, appErr.Message)
+
+	switch {
+	case appErr.Code == "invalid_request":
+		return fmt.Sprintf(`%s, error="invalid_request", error_description="%s"`, realm, desc)
+	case appErr.Kind != KindUnauthorized:
+		return ""
+	case appErr.Code == "missing_token":
+		return realm
+	default:
+		return fmt.Sprintf(`%s, error="invalid_token", error_description="%s"`, realm, desc)
+	}
+}
+
+// change duplicate and foreign key error of every sql driver into AppError
+func sqlError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062:
+			return &AppError{Kind: KindConflict, Code: "conflict", Message: "data already exists", Err: err}
+		case 1451, 1452:
+			return &AppError{Kind: KindValidation, Code: "invalid_reference", Message: "related data not found", Err: err}
+		}
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return &AppError{Kind: KindConflict, Code: "conflict", Message: "data already exists", Err: err}
+		case sqlite3.ErrConstraintForeignKey:
+			return &AppError{Kind: KindValidation, Code: "invalid_reference", Message: "related data not found", Err: err}
+		}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return &AppError{Kind: KindConflict, Code: "conflict", Message: "data already exists", Err: err}
+		case "23503":
+			return &AppError{Kind: KindValidation, Code: "invalid_reference", Message: "related data not found", Err: err}
+		}
+	}
+
+	return err
+}
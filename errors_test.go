@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// every kind is written with its status, code and fields, other error is a generic 500
+func TestWriteError(t *testing.T) {
+	secret := "dial tcp 10.0.0.5:3306: password for root is wrong"
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{"bad request", BadRequestError("bad %s", "input"), http.StatusBadRequest, `{"error":"bad input","code":"bad_request"}`},
+		{"not found", NotFoundError("city: %s not found", "Bandung"), http.StatusNotFound, `{"error":"city: Bandung not found","code":"not_found"}`},
+		{"conflict", ConflictError("email already registered"), http.StatusConflict, `{"error":"email already registered","code":"conflict"}`},
+		{"validation", ValidationError(map[string]string{"email": "is required"}, "invalid body"), http.StatusUnprocessableEntity, `{"error":"invalid body","code":"validation_failed","fields":{"email":"is required"}}`},
+		{"unauthorized", UnauthorizedError("no refresh token"), http.StatusUnauthorized, `{"error":"no refresh token","code":"unauthorized"}`},
+		{"forbidden", ForbiddenError("admin role required"), http.StatusForbidden, `{"error":"admin role required","code":"forbidden"}`},
+		{"payload too large", &AppError{Kind: KindPayloadTooLarge, Code: "body_too_large", Message: "body too large"}, http.StatusRequestEntityTooLarge, `{"error":"body too large","code":"body_too_large"}`},
+		{"wrapped app error", fmt.Errorf("save: %w", NotFoundError("bookmark not found")), http.StatusNotFound, `{"error":"bookmark not found","code":"not_found"}`},
+		{"internal", InternalError(errors.New(secret)), http.StatusInternalServerError, `{"error":"internal server error","code":"internal"}`},
+		{"plain error", errors.New(secret), http.StatusInternalServerError, `{"error":"internal server error","code":"internal"}`},
+		{"sql error", fmt.Errorf("%s: %w", secret, sql.ErrConnDone), http.StatusInternalServerError, `{"error":"internal server error","code":"internal"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			if err := WriteError(w, tt.err); err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("content type %q", ct)
+			}
+
+			if got := strings.TrimSpace(w.Body.String()); got != tt.body {
+				t.Errorf("body %s, want %s", got, tt.body)
+			}
+
+			if strings.Contains(w.Body.String(), "10.0.0.5") {
+				t.Errorf("body leak the error: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+// status of every kind, unknown kind is 500
+func TestErrorKindStatus(t *testing.T) {
+	want := map[ErrorKind]int{
+		KindInternal:        http.StatusInternalServerError,
+		KindBadRequest:      http.StatusBadRequest,
+		KindNotFound:        http.StatusNotFound,
+		KindConflict:        http.StatusConflict,
+		KindValidation:      http.StatusUnprocessableEntity,
+		KindUnauthorized:    http.StatusUnauthorized,
+		KindForbidden:       http.StatusForbidden,
+		KindPayloadTooLarge: http.StatusRequestEntityTooLarge,
+		ErrorKind(100):      http.StatusInternalServerError,
+	}
+
+	got := map[ErrorKind]int{}
+	for kind := range want {
+		got[kind] = (&AppError{Kind: kind}).Status()
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
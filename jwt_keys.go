@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minimum length of HS256 secret
+const minSecretLength = 32
+
+// key to sign and verify JWT, loaded at startup by LoadJWTKeys
+var jwtKeys *JWTKeySet
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// active key sign new token, every key in keys can verify token so old key can be rotated out
+type JWTKeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// load signing key of the config, HS256 use the secret and RS256 or EdDSA use the PEM private key.
+// previous secrets and verify keys are old keys still accepted while they are rotated out
+func LoadJWTKeys(cfg JWTConfig) (*JWTKeySet, error) {
+	var active *signingKey
+	switch cfg.Alg {
+	case jwt.SigningMethodHS256.Alg():
+		key, err := newSecretKey(cfg.Kid, cfg.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.secret: %w", err)
+		}
+		active = key
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+		key, err := loadPrivateKey(cfg.Kid, cfg.Private_Key_File)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.private_key_file: %w", err)
+		}
+
+		if key.method.Alg() != cfg.Alg {
+			return nil, fmt.Errorf("jwt.private_key_file: key is %s but alg is %s", key.method.Alg(), cfg.Alg)
+		}
+		active = key
+	default:
+		return nil, fmt.Errorf("jwt.alg: %s not supported", cfg.Alg)
+	}
+
+	set := &JWTKeySet{
+		active: active,
+		keys:   map[string]*signingKey{active.kid: active},
+	}
+
+	for kid, secret := range cfg.Previous_Secrets {
+		key, err := newSecretKey(kid, secret)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.previous_secrets %s: %w", kid, err)
+		}
+
+		if err := set.add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	for kid, path := range cfg.Verify_Keys {
+		key, err := loadPublicKey(kid, path)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.verify_keys %s: %w", kid, err)
+		}
+
+		if err := set.add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return set, nil
+}
+
+func (set *JWTKeySet) add(key *signingKey) error {
+	if _, ok := set.keys[key.kid]; ok {
+		return fmt.Errorf("jwt kid: %s is used more than once", key.kid)
+	}
+
+	set.keys[key.kid] = key
+	return nil
+}
+
+// sign claims with the active key and put kid in header
+func (set *JWTKeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(set.active.method, claims)
+	token.Header["kid"] = set.active.kid
+
+	return token.SignedString(set.active.sign)
+}
+
+// find verification key by kid, token alg must be the alg of that key
+func (set *JWTKeySet) KeyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	// token created before kid is added
+	if kid == "" {
+		kid = set.active.kid
+	}
+
+	key, ok := set.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+
+	return key.verify, nil
+}
+
+// parse "kid=value,kid=value"
+func parseKeyList(list string) map[string]string {
+	keys := map[string]string{}
+
+	for _, item := range strings.Split(list, ",") {
+		kid, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if ok && kid != "" {
+			keys[kid] = value
+		}
+	}
+
+	return keys
+}
+
+func newSecretKey(kid, secret string) (*signingKey, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("secret is empty")
+	}
+
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+	}
+
+	return &signingKey{
+		kid:    kid,
+		method: jwt.SigningMethodHS256,
+		sign:   []byte(secret),
+		verify: []byte(secret),
+	}, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM", path)
+	}
+
+	return block, nil
+}
+
+// load RSA (PKCS1 or PKCS8) or Ed25519 (PKCS8) private key
+func loadPrivateKey(kid, path string) (*signingKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key must be at least 2048 bits")
+		}
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("key type %T not supported", key)
+	}
+}
+
+// load RSA or Ed25519 public key
+func loadPublicKey(kid, path string) (*signingKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	if block.Type == "RSA PUBLIC KEY" {
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, verify: k}, nil
+	case ed25519.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, verify: k}, nil
+	default:
+		return nil, fmt.Errorf("key type %T not supported", key)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	testRSAKey     *rsa.PrivateKey
+	testEd25519Key ed25519.PrivateKey
+)
+
+func init() {
+	var err error
+	if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+
+	if _, testEd25519Key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+// write PEM block into a file of a temp dir and return its path
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func marshalPKCS8(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func marshalPKIX(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func testClaims() *ClaimsType {
+	return &ClaimsType{
+		User_ID:    "user",
+		Token_Type: tokenTypeSession,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+// parse token with the key set, error if it is not valid
+func verifyWith(set *JWTKeySet, token string) error {
+	_, err := jwt.ParseWithClaims(token, new(ClaimsType), set.KeyFunc)
+	return err
+}
+
+func mustLoadJWTKeys(t *testing.T, cfg JWTConfig) *JWTKeySet {
+	t.Helper()
+
+	set, err := LoadJWTKeys(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return set
+}
+
+// every supported alg sign a token that the same set verify, kid is in the header
+func TestLoadJWTKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(t *testing.T) JWTConfig
+		alg  string
+	}{
+		{"HS256", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "HS256", Kid: "k1", Secret: testSecret}
+		}, "HS256"},
+		{"RS256 PKCS1", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "RS256", Kid: "k1", Private_Key_File: writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(testRSAKey))}
+		}, "RS256"},
+		{"RS256 PKCS8", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "RS256", Kid: "k1", Private_Key_File: writePEM(t, "rsa.pem", "PRIVATE KEY", marshalPKCS8(t, testRSAKey))}
+		}, "RS256"},
+		{"EdDSA", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "EdDSA", Kid: "k1", Private_Key_File: writePEM(t, "ed25519.pem", "PRIVATE KEY", marshalPKCS8(t, testEd25519Key))}
+		}, "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := mustLoadJWTKeys(t, tt.cfg(t))
+
+			signed, err := set.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := jwt.ParseWithClaims(signed, new(ClaimsType), set.KeyFunc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if token.Method.Alg() != tt.alg || token.Header["kid"] != "k1" {
+				t.Errorf("got alg %s kid %v, want %s k1", token.Method.Alg(), token.Header["kid"], tt.alg)
+			}
+		})
+	}
+}
+
+func TestLoadJWTKeysRefused(t *testing.T) {
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  func(t *testing.T) JWTConfig
+		err  string
+	}{
+		{"empty secret", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "HS256", Kid: "k1"}
+		}, "secret is empty"},
+		{"short secret", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "HS256", Kid: "k1", Secret: strings.Repeat("x", minSecretLength-1)}
+		}, "at least 32 bytes"},
+		{"short previous secret", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "HS256", Kid: "k1", Secret: testSecret, Previous_Secrets: map[string]string{"k0": "short"}}
+		}, "jwt.previous_secrets k0"},
+		{"unsupported alg", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "HS512", Kid: "k1", Secret: testSecret}
+		}, "not supported"},
+		{"missing key file", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "RS256", Kid: "k1", Private_Key_File: filepath.Join(t.TempDir(), "missing.pem")}
+		}, "jwt.private_key_file"},
+		{"no key file", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "EdDSA", Kid: "k1"}
+		}, "path is empty"},
+		{"not PEM", func(t *testing.T) JWTConfig {
+			path := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			return JWTConfig{Alg: "RS256", Kid: "k1", Private_Key_File: path}
+		}, "is not PEM"},
+		{"key does not match alg", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "RS256", Kid: "k1", Private_Key_File: writePEM(t, "ed25519.pem", "PRIVATE KEY", marshalPKCS8(t, testEd25519Key))}
+		}, "key is EdDSA but alg is RS256"},
+		{"small RSA key", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "RS256", Kid: "k1", Private_Key_File: writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(smallRSA))}
+		}, "at least 2048 bits"},
+		{"kid used twice", func(t *testing.T) JWTConfig {
+			return JWTConfig{Alg: "HS256", Kid: "k1", Secret: testSecret, Previous_Secrets: map[string]string{"k1": testSecret}}
+		}, "used more than once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadJWTKeys(tt.cfg(t))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// token of the old kid is still accepted after rotation and new token is signed with the new kid
+func TestJWTKeyRotation(t *testing.T) {
+	const oldSecret = "old-secret-that-is-long-enough-for-hs256"
+
+	oldSet := mustLoadJWTKeys(t, JWTConfig{Alg: "HS256", Kid: "old", Secret: oldSecret})
+	oldToken, err := oldSet.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the old RSA key is kept as verify key while EdDSA become the active key
+	oldRSA := mustLoadJWTKeys(t, JWTConfig{Alg: "RS256", Kid: "old-rsa", Private_Key_File: writePEM(t, "rsa.pem", "PRIVATE KEY", marshalPKCS8(t, testRSAKey))})
+	oldRSAToken, err := oldRSA.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSet := mustLoadJWTKeys(t, JWTConfig{
+		Alg:              "EdDSA",
+		Kid:              "new",
+		Private_Key_File: writePEM(t, "ed25519.pem", "PRIVATE KEY", marshalPKCS8(t, testEd25519Key)),
+		Previous_Secrets: map[string]string{"old": oldSecret},
+		Verify_Keys:      map[string]string{"old-rsa": writePEM(t, "rsa.pub", "PUBLIC KEY", marshalPKIX(t, &testRSAKey.PublicKey))},
+	})
+
+	newToken, err := newSet.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		set   *JWTKeySet
+		token string
+		valid bool
+	}{
+		{"old secret kid verify", newSet, oldToken, true},
+		{"old rsa kid verify", newSet, oldRSAToken, true},
+		{"new kid sign", newSet, newToken, true},
+		{"new kid unknown to old set", oldSet, newToken, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyWith(tt.set, tt.token); (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+
+	token, _, err := new(jwt.Parser).ParseUnverified(newToken, new(ClaimsType))
+	if err != nil || token.Header["kid"] != "new" {
+		t.Errorf("new token kid %v, %v", token.Header["kid"], err)
+	}
+}
+
+// kid pick the key, alg of the token must be the alg of that key
+func TestJWTKeyFunc(t *testing.T) {
+	pubPath := writePEM(t, "rsa.pub", "PUBLIC KEY", marshalPKIX(t, &testRSAKey.PublicKey))
+	set := mustLoadJWTKeys(t, JWTConfig{Alg: "HS256", Kid: "hs", Secret: testSecret, Verify_Keys: map[string]string{"rsa": pubPath}})
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		t.Helper()
+
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+
+	pubPEM, err := os.ReadFile(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"matching alg", sign(jwt.SigningMethodHS256, "hs", []byte(testSecret)), true},
+		{"no kid use active key", sign(jwt.SigningMethodHS256, "", []byte(testSecret)), true},
+		{"rsa kid", sign(jwt.SigningMethodRS256, "rsa", testRSAKey), true},
+		{"HS384 for HS256 kid", sign(jwt.SigningMethodHS384, "hs", []byte(testSecret)), false},
+		{"RS256 for HS256 kid", sign(jwt.SigningMethodRS256, "hs", testRSAKey), false},
+		// the public key is known to everyone, it must not be usable as HMAC secret
+		{"HS256 for RS256 kid", sign(jwt.SigningMethodHS256, "rsa", pubPEM), false},
+		{"unknown kid", sign(jwt.SigningMethodHS256, "unknown", []byte(testSecret)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyWith(set, tt.token); (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
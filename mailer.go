@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/gomail.v2"
+)
+
+type Mailer interface {
+	Send(msg *MailType) error
+}
+
+// pick mailer base on the config (smtp, file or memory)
+func NewMailer(cfg MailConfig) (Mailer, error) {
+	switch cfg.Mailer {
+	case "", "smtp":
+		return NewSMTPMailer(cfg.SMTP), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.SMTP.Username)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("mailer: %s not supported", cfg.Mailer)
+	}
+}
+
+// build gomail message from MailType, multipart/alternative when it has plain text body
+func newMailMessage(from string, msg *MailType) *gomail.Message {
+	mailer := gomail.NewMessage()
+	mailer.SetHeader("From", from)
+	mailer.SetAddressHeader("To", msg.To, msg.To_Name)
+	mailer.SetHeader("Subject", msg.Subject)
+
+	if msg.Text_Body != "" {
+		mailer.SetBody("text/plain", msg.Text_Body)
+		mailer.AddAlternative("text/html", msg.HTML_Body)
+	} else {
+		mailer.SetBody("text/html", msg.HTML_Body)
+	}
+
+	return mailer
+}
+
+func senderName(email string) string {
+	return fmt.Sprintf("RoadTrip <%v>", email)
+}
+
+// SMTP mailer
+type SMTPMailer struct {
+	dialer *gomail.Dialer
+	from   string
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	dialer := gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)
+
+	// ssl for implicit TLS, insecure to skip certificate check
+	switch cfg.TLS {
+	case "ssl":
+		dialer.SSL = true
+	case "insecure":
+		dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true, ServerName: cfg.Host}
+	}
+
+	return &SMTPMailer{
+		dialer: dialer,
+		from:   senderName(cfg.Username),
+	}
+}
+
+func (m *SMTPMailer) Send(msg *MailType) error {
+	return m.dialer.DialAndSend(newMailMessage(m.from, msg))
+}
+
+// write every email as .eml file into a directory
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if dir == "" {
+		dir = "mail"
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{
+		dir:  dir,
+		from: senderName(from),
+	}, nil
+}
+
+func (m *FileMailer) Send(msg *MailType) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102150405"), uuid.New().String())
+
+	file, err := os.Create(filepath.Join(m.dir, name))
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if _, err := newMailMessage(m.from, msg).WriteTo(file); err != nil {
+		return err
+	}
+
+	log.Println("mail written to", file.Name())
+
+	return nil
+}
+
+// keep every email in memory
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []*MailType
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(msg *MailType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+
+	return nil
+}
+
+// get all sent email
+func (m *MemoryMailer) Messages() []*MailType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]*MailType, len(m.messages))
+	copy(messages, m.messages)
+
+	return messages
+}
+
+// get last sent email to address
+func (m *MemoryMailer) LastMessage(email string) (*MailType, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == email {
+			return m.messages[i], true
+		}
+	}
+
+	return nil, false
+}
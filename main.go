@@ -1,28 +1,111 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	store, err := NewMysqlStore()
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// bad key config fail before anything is done to the database
+	keys, err := LoadJWTKeys(cfg.JWT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwtKeys = keys
+	accessTokenTTL = cfg.JWT.Access_Token_TTL
+	refreshTokenTTL = cfg.JWT.Refresh_Token_TTL
+
+	store, err := NewStorage(cfg.Database)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	defer store.Close()
+
+	// run migration command instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(store, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := store.init(); err != nil {
 		log.Fatal(err)
 	}
 
-	defer store.db.Close()
+	// change role of user instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "promote" {
+		if err := runPromote(store, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000"
+	mailer, err := NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	server := NewApiServer("0.0.0.0:"+port, store)
-	server.Run()
+	emails, err := LoadEmailTemplates(cfg.Mail.Template_Dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// handler only queue email, the worker send it in background
+	outbox, worker := NewOutbox(store, mailer, cfg.Mail)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	worker.Start()
+
+	server := NewApiServer(cfg, store, outbox, emails)
+	if err := server.Run(ctx); err != nil {
+		log.Println("server:", err)
+	}
+
+	// send email that is still due before exit
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := worker.Shutdown(shutdownCtx); err != nil {
+		log.Println("outbox:", err)
+	}
+}
+
+// handle command: promote <email> [role], role default is admin
+func runPromote(store Storage, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: promote <email> [user|editor|admin]")
+	}
+
+	role := roleAdmin
+	if len(args) == 2 {
+		role = args[1]
+	}
+
+	if _, ok := roleRank[role]; !ok {
+		return fmt.Errorf("role: %s not supported", role)
+	}
+
+	account, err := store.UpdateUserRole(args[0], role)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is now %s\n", account.Email, account.Role)
+
+	return nil
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testSecret = "test-secret-that-is-long-enough-for-hs256"
+
+func TestMain(m *testing.M) {
+	keys, err := LoadJWTKeys(JWTConfig{Alg: "HS256", Kid: "test", Secret: testSecret})
+	if err != nil {
+		panic(err)
+	}
+	jwtKeys = keys
+
+	// handler and migration log is noise in test and benchmark output
+	log.SetOutput(io.Discard)
+
+	os.Exit(m.Run())
+}
+
+// api server with memory store and memory mailer
+type testServer struct {
+	*httptest.Server
+	api    *APIServer
+	store  *MemoryStore
+	mailer *MemoryMailer
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	emails, err := LoadEmailTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	mailer := NewMemoryMailer()
+	api := NewApiServer(defaultConfig(), store, mailer, emails)
+
+	ts := &testServer{Server: httptest.NewServer(api.routes()), api: api, store: store, mailer: mailer}
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// send json request, response body is decoded into out if not nil
+func (ts *testServer) request(t *testing.T, method, path, token string, body, out any) int {
+	t.Helper()
+
+	status, err := ts.send(method, path, token, body, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return status
+}
+
+// same as request but return the error, so it can be used from other goroutine
+// where t.Fatal is not allowed
+func (ts *testServer) send(method, path, token string, body, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			return 0, fmt.Errorf("%s %s: decode response: %w", method, path, err)
+		}
+	}
+
+	return res.StatusCode, nil
+}
+
+// token in the sign in link of email
+func linkToken(t *testing.T, msg *MailType) string {
+	t.Helper()
+
+	_, escaped, ok := strings.Cut(msg.Link, "/auth/")
+	if !ok {
+		t.Fatalf("link %q has no token", msg.Link)
+	}
+
+	token, err := url.PathUnescape(escaped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// sign up new user and exchange the emailed link, return the access token
+func (ts *testServer) signUp(t *testing.T, name, email string) string {
+	t.Helper()
+
+	if status := ts.request(t, "POST", "/signup", "", map[string]string{"user_name": name, "email": email}, nil); status != http.StatusOK {
+		t.Fatalf("signup %s: status %d", email, status)
+	}
+
+	msg, ok := ts.mailer.LastMessage(email)
+	if !ok {
+		t.Fatalf("no sign in email to %s", email)
+	}
+
+	var tokens map[string]any
+	if status := ts.request(t, "GET", "/auth/"+linkToken(t, msg), "", nil, &tokens); status != http.StatusOK {
+		t.Fatalf("verify sign in %s: status %d", email, status)
+	}
+
+	return tokens["token"].(string)
+}
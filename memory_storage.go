@@ -0,0 +1,1258 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// in memory storage for test and local development
+type MemoryStore struct {
+	*memoryData
+
+	// inside WithTx the lock is already held by the transaction
+	inTx bool
+}
+
+type memoryData struct {
+	mu           sync.RWMutex
+	users        []*AccountType
+	cities       []*CityType
+	destinations []*DestinationType
+	images       []*ImageType
+	bookmarks    []*BookmarkType
+	user_saves   []*userSaveRow
+	magic_links  []*magicLinkRow
+	refresh      []*RefreshTokenType
+	revoked      map[string]int64
+	sessions     []*SessionType
+	outbox       []*OutboxMessageType
+}
+
+type userSaveRow struct {
+	User_Save_ID   string
+	Destination_ID string
+	Bookmark_ID    string
+}
+
+type magicLinkRow struct {
+	MagicLinkType
+	Used bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memoryData: &memoryData{revoked: map[string]int64{}}}
+}
+
+func (s *MemoryStore) lock() {
+	if !s.inTx {
+		s.mu.Lock()
+	}
+}
+
+func (s *MemoryStore) unlock() {
+	if !s.inTx {
+		s.mu.Unlock()
+	}
+}
+
+func (s *MemoryStore) rlock() {
+	if !s.inTx {
+		s.mu.RLock()
+	}
+}
+
+func (s *MemoryStore) runlock() {
+	if !s.inTx {
+		s.mu.RUnlock()
+	}
+}
+
+// deep copy of every table, used to rollback transaction
+func (d *memoryData) snapshot() *memoryData {
+	snap := &memoryData{}
+
+	for _, u := range d.users {
+		c := *u
+		snap.users = append(snap.users, &c)
+	}
+	for _, city := range d.cities {
+		c := *city
+		snap.cities = append(snap.cities, &c)
+	}
+	for _, des := range d.destinations {
+		c := *des
+		snap.destinations = append(snap.destinations, &c)
+	}
+	for _, img := range d.images {
+		c := *img
+		snap.images = append(snap.images, &c)
+	}
+	for _, book := range d.bookmarks {
+		c := *book
+		snap.bookmarks = append(snap.bookmarks, &c)
+	}
+	for _, save := range d.user_saves {
+		c := *save
+		snap.user_saves = append(snap.user_saves, &c)
+	}
+	for _, link := range d.magic_links {
+		c := *link
+		snap.magic_links = append(snap.magic_links, &c)
+	}
+	for _, token := range d.refresh {
+		c := *token
+		snap.refresh = append(snap.refresh, &c)
+	}
+	for _, sess := range d.sessions {
+		c := *sess
+		snap.sessions = append(snap.sessions, &c)
+	}
+	for _, msg := range d.outbox {
+		c := *msg
+		snap.outbox = append(snap.outbox, &c)
+	}
+	snap.revoked = map[string]int64{}
+	for jti, exp := range d.revoked {
+		snap.revoked[jti] = exp
+	}
+
+	return snap
+}
+
+// run fn while holding the lock, every change is reverted if fn return error
+func (s *MemoryStore) WithTx(fn func(tx Storage) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := s.snapshot()
+
+	if err := fn(&MemoryStore{memoryData: s.memoryData, inTx: true}); err != nil {
+		s.users = snap.users
+		s.cities = snap.cities
+		s.destinations = snap.destinations
+		s.images = snap.images
+		s.bookmarks = snap.bookmarks
+		s.user_saves = snap.user_saves
+		s.magic_links = snap.magic_links
+		s.refresh = snap.refresh
+		s.revoked = snap.revoked
+		s.sessions = snap.sessions
+		s.outbox = snap.outbox
+		return err
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) init() error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// check email
+func (s *MemoryStore) CheckEmail(email string) (*AccountType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	email = normalizeEmail(email)
+
+	for _, u := range s.users {
+		if u.Email == email {
+			acc := *u
+			return &acc, nil
+		}
+	}
+
+	return nil, NotFoundError("account %s not found", email)
+}
+
+// Sign Up
+func (s *MemoryStore) SignUp(acc *SignUpType) (*AccountType, error) {
+	s.lock()
+	defer s.unlock()
+
+	email := normalizeEmail(acc.Email)
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return nil, ConflictError("email: %s already registered", email)
+		}
+	}
+
+	account := &AccountType{
+		User_ID:   uuid.New().String(),
+		User_Name: strings.TrimSpace(acc.User_Name),
+		Email:     email,
+		Locale:    acc.Locale,
+		Role:      roleUser,
+	}
+	s.users = append(s.users, account)
+
+	newAcc := *account
+	return &newAcc, nil
+}
+
+// get account by id
+func (s *MemoryStore) GetAccount(user_id string) (*AccountType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, u := range s.users {
+		if u.User_ID == user_id {
+			acc := *u
+			return &acc, nil
+		}
+	}
+
+	return nil, NotFoundError("user %s not found", user_id)
+}
+
+// change preferred email language of user
+func (s *MemoryStore) UpdateUserLocale(user_id, locale string) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, u := range s.users {
+		if u.User_ID == user_id {
+			u.Locale = locale
+			return nil
+		}
+	}
+
+	return NotFoundError("user %s not found", user_id)
+}
+
+// change role of user found by email
+func (s *MemoryStore) UpdateUserRole(email, role string) (*AccountType, error) {
+	s.lock()
+	defer s.unlock()
+
+	email = normalizeEmail(email)
+
+	for _, u := range s.users {
+		if u.Email == email {
+			u.Role = role
+			acc := *u
+			return &acc, nil
+		}
+	}
+
+	return nil, NotFoundError("account %s not found", email)
+}
+
+// create new city
+func (s *MemoryStore) CreateNewCity(city *CreateNewCityType) (*CityType, error) {
+	s.lock()
+	defer s.unlock()
+
+	for _, c := range s.cities {
+		if c.City_Name == city.City_Name {
+			return nil, ConflictError("city: %s already exists", city.City_Name)
+		}
+	}
+
+	newCity := &CityType{
+		City_ID:   uuid.New().String(),
+		City_Name: city.City_Name,
+		City_Lat:  *city.City_Lat,
+		City_Long: *city.City_Long,
+	}
+	s.cities = append(s.cities, newCity)
+
+	c := *newCity
+	return &c, nil
+}
+
+// first check the city its there or not
+func (s *MemoryStore) CheckCity(c string) (*CityType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, city := range s.cities {
+		if city.City_Name == c {
+			newCity := *city
+			return &newCity, nil
+		}
+	}
+
+	return nil, NotFoundError("city: %s not found", c)
+}
+
+// create new destination
+func (s *MemoryStore) CreateNewDestination(des *CreateNewDestinationType) (*DestinationType, error) {
+	s.lock()
+	defer s.unlock()
+
+	if s.findCity(des.City_ID) == nil {
+		return nil, invalidReferenceError()
+	}
+
+	newDes := &DestinationType{
+		Destination_ID:   uuid.New().String(),
+		Destination_Name: des.Destination_Name,
+		Destination_URL:  des.Destination_URL,
+		Destination_Lat:  *des.Destination_Lat,
+		Destination_Long: *des.Destination_Long,
+		City_ID:          des.City_ID,
+	}
+	s.destinations = append(s.destinations, newDes)
+
+	d := *newDes
+	return &d, nil
+}
+
+// find cover image of destination, the one with smallest image_id like coverImageJoin
+// of sql storage, nil if destination has no image, must hold the lock
+func (s *MemoryStore) coverImage(des_id string) *string {
+	var cover *ImageType
+	for _, img := range s.images {
+		if img.Destination_ID == des_id && (cover == nil || img.Image_ID < cover.Image_ID) {
+			cover = img
+		}
+	}
+
+	if cover == nil {
+		return nil
+	}
+
+	url := cover.Image_URL
+	return &url
+}
+
+// if city is there get all destination data base on city
+func (s *MemoryStore) GetAllDestination(city_id string) ([]*AllDestinationType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	allDestination := []*AllDestinationType{}
+	for _, des := range s.destinations {
+		if des.City_ID != city_id {
+			continue
+		}
+
+		allDestination = append(allDestination, &AllDestinationType{
+			Destination_ID:   des.Destination_ID,
+			Destination_Name: des.Destination_Name,
+			Destination_URL:  des.Destination_URL,
+			Destination_Lat:  des.Destination_Lat,
+			Destination_Long: des.Destination_Long,
+			Image_URL:        s.coverImage(des.Destination_ID),
+		})
+	}
+
+	// same order as sql storage
+	sort.Slice(allDestination, func(i, j int) bool {
+		return allDestination[i].Destination_ID < allDestination[j].Destination_ID
+	})
+
+	return allDestination, nil
+}
+
+// get single destination
+func (s *MemoryStore) GetDestination(des_id string) (*DestinationType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, des := range s.destinations {
+		if des.Destination_ID == des_id {
+			d := *des
+			return &d, nil
+		}
+	}
+
+	return nil, NotFoundError("destination id: %s not found", des_id)
+}
+
+// create new images
+func (s *MemoryStore) CreateNewImage(img *CreateNewImageType) (*ImageType, error) {
+	s.lock()
+	defer s.unlock()
+
+	if s.findDestination(img.Destination_ID) == nil {
+		return nil, invalidReferenceError()
+	}
+
+	newImg := &ImageType{
+		Image_ID:       uuid.New().String(),
+		Image_URL:      img.Image_URL,
+		Destination_ID: img.Destination_ID,
+	}
+	s.images = append(s.images, newImg)
+
+	i := *newImg
+	return &i, nil
+}
+
+// get all Image
+func (s *MemoryStore) GetAllImages(des_id string) ([]*ImageType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	images := []*ImageType{}
+	for _, img := range s.images {
+		if img.Destination_ID == des_id {
+			i := *img
+			images = append(images, &i)
+		}
+	}
+
+	return images, nil
+}
+
+// same error as foreign key error of sql storage
+func invalidReferenceError() *AppError {
+	return &AppError{Kind: KindValidation, Code: "invalid_reference", Message: "related data not found"}
+}
+
+// must hold the lock
+func (s *MemoryStore) findUser(user_id string) *AccountType {
+	for _, u := range s.users {
+		if u.User_ID == user_id {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// must hold the lock
+func (s *MemoryStore) findCity(city_id string) *CityType {
+	for _, city := range s.cities {
+		if city.City_ID == city_id {
+			return city
+		}
+	}
+
+	return nil
+}
+
+// must hold the lock
+func (s *MemoryStore) findDestination(des_id string) *DestinationType {
+	for _, des := range s.destinations {
+		if des.Destination_ID == des_id {
+			return des
+		}
+	}
+
+	return nil
+}
+
+// must hold the lock
+func (s *MemoryStore) findImage(image_id string) *ImageType {
+	for _, img := range s.images {
+		if img.Image_ID == image_id {
+			return img
+		}
+	}
+
+	return nil
+}
+
+// remove destination with its image and user_save rows like the foreign key cascade, must hold the lock
+func (s *MemoryStore) deleteDestinations(match func(des *DestinationType) bool) {
+	deleted := map[string]bool{}
+
+	destinations := s.destinations[:0]
+	for _, des := range s.destinations {
+		if match(des) {
+			deleted[des.Destination_ID] = true
+		} else {
+			destinations = append(destinations, des)
+		}
+	}
+	s.destinations = destinations
+
+	images := s.images[:0]
+	for _, img := range s.images {
+		if !deleted[img.Destination_ID] {
+			images = append(images, img)
+		}
+	}
+	s.images = images
+
+	user_saves := s.user_saves[:0]
+	for _, save := range s.user_saves {
+		if !deleted[save.Destination_ID] {
+			user_saves = append(user_saves, save)
+		}
+	}
+	s.user_saves = user_saves
+}
+
+// get all city sorted by name
+func (s *MemoryStore) GetAllCities() ([]*CityType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	cities := []*CityType{}
+	for _, city := range s.cities {
+		c := *city
+		cities = append(cities, &c)
+	}
+
+	// same order as sql storage
+	sort.SliceStable(cities, func(i, j int) bool {
+		return cities[i].City_Name < cities[j].City_Name
+	})
+
+	return cities, nil
+}
+
+// get city by id
+func (s *MemoryStore) GetCity(city_id string) (*CityType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	city := s.findCity(city_id)
+	if city == nil {
+		return nil, NotFoundError("city id: %s not found", city_id)
+	}
+
+	c := *city
+	return &c, nil
+}
+
+// update city
+func (s *MemoryStore) UpdateCity(city_id string, city *CreateNewCityType) (*CityType, error) {
+	s.lock()
+	defer s.unlock()
+
+	old := s.findCity(city_id)
+	if old == nil {
+		return nil, NotFoundError("city id: %s not found", city_id)
+	}
+
+	for _, c := range s.cities {
+		if c.City_ID != city_id && c.City_Name == city.City_Name {
+			return nil, ConflictError("city: %s already exists", city.City_Name)
+		}
+	}
+
+	old.City_Name = city.City_Name
+	old.City_Lat = *city.City_Lat
+	old.City_Long = *city.City_Long
+
+	c := *old
+	return &c, nil
+}
+
+// delete city
+func (s *MemoryStore) DeleteCity(city_id string) error {
+	s.lock()
+	defer s.unlock()
+
+	if s.findCity(city_id) == nil {
+		return NotFoundError("city id: %s not found", city_id)
+	}
+
+	s.deleteDestinations(func(des *DestinationType) bool {
+		return des.City_ID == city_id
+	})
+
+	cities := s.cities[:0]
+	for _, city := range s.cities {
+		if city.City_ID != city_id {
+			cities = append(cities, city)
+		}
+	}
+	s.cities = cities
+
+	return nil
+}
+
+// get all destination of city without cover image
+func (s *MemoryStore) GetDestinationsByCity(city_id string) ([]*DestinationType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	if s.findCity(city_id) == nil {
+		return nil, NotFoundError("city id: %s not found", city_id)
+	}
+
+	destinations := []*DestinationType{}
+	for _, des := range s.destinations {
+		if des.City_ID == city_id {
+			d := *des
+			destinations = append(destinations, &d)
+		}
+	}
+
+	// same order as sql storage
+	sort.SliceStable(destinations, func(i, j int) bool {
+		return destinations[i].Destination_Name < destinations[j].Destination_Name
+	})
+
+	return destinations, nil
+}
+
+// update destination
+func (s *MemoryStore) UpdateDestination(des_id string, des *CreateNewDestinationType) (*DestinationType, error) {
+	s.lock()
+	defer s.unlock()
+
+	old := s.findDestination(des_id)
+	if old == nil {
+		return nil, NotFoundError("destination id: %s not found", des_id)
+	}
+
+	if s.findCity(des.City_ID) == nil {
+		return nil, invalidReferenceError()
+	}
+
+	old.Destination_Name = des.Destination_Name
+	old.Destination_URL = des.Destination_URL
+	old.Destination_Lat = *des.Destination_Lat
+	old.Destination_Long = *des.Destination_Long
+	old.City_ID = des.City_ID
+
+	d := *old
+	return &d, nil
+}
+
+// delete destination
+func (s *MemoryStore) DeleteDestination(des_id string) error {
+	s.lock()
+	defer s.unlock()
+
+	if s.findDestination(des_id) == nil {
+		return NotFoundError("destination id: %s not found", des_id)
+	}
+
+	s.deleteDestinations(func(des *DestinationType) bool {
+		return des.Destination_ID == des_id
+	})
+
+	return nil
+}
+
+// get image by id
+func (s *MemoryStore) GetImage(image_id string) (*ImageType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	img := s.findImage(image_id)
+	if img == nil {
+		return nil, NotFoundError("image id: %s not found", image_id)
+	}
+
+	i := *img
+	return &i, nil
+}
+
+// update image
+func (s *MemoryStore) UpdateImage(image_id string, img *CreateNewImageType) (*ImageType, error) {
+	s.lock()
+	defer s.unlock()
+
+	old := s.findImage(image_id)
+	if old == nil {
+		return nil, NotFoundError("image id: %s not found", image_id)
+	}
+
+	if s.findDestination(img.Destination_ID) == nil {
+		return nil, invalidReferenceError()
+	}
+
+	old.Image_URL = img.Image_URL
+	old.Destination_ID = img.Destination_ID
+
+	i := *old
+	return &i, nil
+}
+
+// delete image
+func (s *MemoryStore) DeleteImage(image_id string) error {
+	s.lock()
+	defer s.unlock()
+
+	if s.findImage(image_id) == nil {
+		return NotFoundError("image id: %s not found", image_id)
+	}
+
+	images := s.images[:0]
+	for _, img := range s.images {
+		if img.Image_ID != image_id {
+			images = append(images, img)
+		}
+	}
+	s.images = images
+
+	return nil
+}
+
+// create new bookmark
+func (s *MemoryStore) CreateNewBookmark(book *NewBookmarkType) (*BookmarkType, error) {
+	s.lock()
+	defer s.unlock()
+
+	if s.findUser(book.User_ID) == nil {
+		return nil, invalidReferenceError()
+	}
+
+	newBook := &BookmarkType{
+		Bookmark_ID:   uuid.New().String(),
+		Bookmark_Name: book.Bookmark_Name,
+		User_ID:       book.User_ID,
+	}
+	s.bookmarks = append(s.bookmarks, newBook)
+
+	b := *newBook
+	return &b, nil
+}
+
+// get all bookmark
+func (s *MemoryStore) GetAllBookmark(user_id string) ([]*BookmarkType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	bookmarks := []*BookmarkType{}
+	for _, book := range s.bookmarks {
+		if book.User_ID == user_id {
+			b := *book
+			bookmarks = append(bookmarks, &b)
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// check the bookmark is there and belongs to user, must hold the lock
+func (s *MemoryStore) checkBookmarkOwner(user_id, bookmark_id string) error {
+	// bookmark of other user is not found either, so the id can not be guessed
+	for _, book := range s.bookmarks {
+		if book.Bookmark_ID == bookmark_id && book.User_ID == user_id {
+			return nil
+		}
+	}
+
+	return NotFoundError("bookmark id: %s not found", bookmark_id)
+}
+
+// save bookmark data
+func (s *MemoryStore) SaveBookmarkData(user_id string, newSave *CreateNewUser_SaveType) error {
+	s.lock()
+	defer s.unlock()
+
+	if err := s.checkBookmarkOwner(user_id, newSave.Bookmark_ID); err != nil {
+		return err
+	}
+
+	if s.findDestination(newSave.Destination_ID) == nil {
+		return invalidReferenceError()
+	}
+
+	for _, save := range s.user_saves {
+		if save.Bookmark_ID == newSave.Bookmark_ID && save.Destination_ID == newSave.Destination_ID {
+			return ConflictError("destination id: %s already saved in bookmark", newSave.Destination_ID)
+		}
+	}
+
+	s.user_saves = append(s.user_saves, &userSaveRow{
+		User_Save_ID:   uuid.New().String(),
+		Destination_ID: newSave.Destination_ID,
+		Bookmark_ID:    newSave.Bookmark_ID,
+	})
+
+	return nil
+}
+
+// get all data from bookmark
+func (s *MemoryStore) GetAllDataByBookmark(user_id, bookmark_id string) ([]*SendDataUser_SaveType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	if err := s.checkBookmarkOwner(user_id, bookmark_id); err != nil {
+		return nil, err
+	}
+
+	user_save_data := []*SendDataUser_SaveType{}
+	for _, save := range s.user_saves {
+		if save.Bookmark_ID != bookmark_id {
+			continue
+		}
+
+		var des *DestinationType
+		for _, d := range s.destinations {
+			if d.Destination_ID == save.Destination_ID {
+				des = d
+				break
+			}
+		}
+
+		// same as inner join, skip save without destination
+		if des == nil {
+			continue
+		}
+
+		var city *CityType
+		for _, c := range s.cities {
+			if c.City_ID == des.City_ID {
+				city = c
+				break
+			}
+		}
+
+		if city == nil {
+			return nil, NotFoundError("city: %s not found", des.City_ID)
+		}
+
+		user_save_data = append(user_save_data, &SendDataUser_SaveType{
+			City_Name:        city.City_Name,
+			City_ID:          city.City_ID,
+			User_Save_ID:     save.User_Save_ID,
+			Destination_ID:   des.Destination_ID,
+			Destination_Name: des.Destination_Name,
+			Destination_URL:  des.Destination_URL,
+			Image_URL:        s.coverImage(des.Destination_ID),
+		})
+	}
+
+	// same order as sql storage
+	sort.Slice(user_save_data, func(i, j int) bool {
+		return user_save_data[i].User_Save_ID < user_save_data[j].User_Save_ID
+	})
+
+	return user_save_data, nil
+}
+
+// update bookmark name
+func (s *MemoryStore) UpdateBookmarkName(user_id, bookmark_id string, name *UpdateBookmarkNameType) error {
+	s.lock()
+	defer s.unlock()
+
+	if err := s.checkBookmarkOwner(user_id, bookmark_id); err != nil {
+		return err
+	}
+
+	for _, book := range s.bookmarks {
+		if book.Bookmark_ID == bookmark_id {
+			book.Bookmark_Name = name.Bookmark_Name
+		}
+	}
+
+	return nil
+}
+
+// delete bookmark
+func (s *MemoryStore) DeleteBookmark(user_id, bookmark_id string) error {
+	s.lock()
+	defer s.unlock()
+
+	if err := s.checkBookmarkOwner(user_id, bookmark_id); err != nil {
+		return err
+	}
+
+	user_saves := s.user_saves[:0]
+	for _, save := range s.user_saves {
+		if save.Bookmark_ID != bookmark_id {
+			user_saves = append(user_saves, save)
+		}
+	}
+	s.user_saves = user_saves
+
+	bookmarks := s.bookmarks[:0]
+	for _, book := range s.bookmarks {
+		if book.Bookmark_ID != bookmark_id {
+			bookmarks = append(bookmarks, book)
+		}
+	}
+	s.bookmarks = bookmarks
+
+	return nil
+}
+
+// delete bookmark data
+func (s *MemoryStore) DeleteBookmarkData(user_id, user_save_id string) error {
+	s.lock()
+	defer s.unlock()
+
+	for i, save := range s.user_saves {
+		if save.User_Save_ID != user_save_id {
+			continue
+		}
+
+		if err := s.checkBookmarkOwner(user_id, save.Bookmark_ID); err != nil {
+			return err
+		}
+
+		s.user_saves = append(s.user_saves[:i], s.user_saves[i+1:]...)
+		return nil
+	}
+
+	return NotFoundError("user save id: %s not found", user_save_id)
+}
+
+// save nonce of sign in link
+func (s *MemoryStore) SaveMagicLink(link *MagicLinkType) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, l := range s.magic_links {
+		if l.Nonce == link.Nonce {
+			return ConflictError("nonce: %s already exists", link.Nonce)
+		}
+	}
+
+	s.magic_links = append(s.magic_links, &magicLinkRow{MagicLinkType: *link})
+
+	return nil
+}
+
+// mark sign in link as used, fail if it is already used or expired
+func (s *MemoryStore) ConsumeMagicLink(nonce string) (*MagicLinkType, error) {
+	s.lock()
+	defer s.unlock()
+
+	for _, l := range s.magic_links {
+		if l.Nonce != nonce {
+			continue
+		}
+
+		if l.Expires_At <= time.Now().Unix() {
+			return nil, UnauthorizedError("sign in link expired")
+		}
+
+		if l.Used {
+			return nil, UnauthorizedError("sign in link already used")
+		}
+
+		l.Used = true
+
+		link := l.MagicLinkType
+		return &link, nil
+	}
+
+	return nil, UnauthorizedError("sign in link invalid")
+}
+
+// save refresh token
+func (s *MemoryStore) SaveRefreshToken(token *RefreshTokenType) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, t := range s.refresh {
+		if t.Token_Hash == token.Token_Hash {
+			return ConflictError("refresh token already exists")
+		}
+	}
+
+	t := *token
+	s.refresh = append(s.refresh, &t)
+
+	return nil
+}
+
+// get refresh token by hash
+func (s *MemoryStore) GetRefreshToken(token_hash string) (*RefreshTokenType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, t := range s.refresh {
+		if t.Token_Hash == token_hash {
+			token := *t
+			return &token, nil
+		}
+	}
+
+	return nil, UnauthorizedError("refresh token invalid")
+}
+
+// mark refresh token as used, false if it is already used by other request
+func (s *MemoryStore) UseRefreshToken(token_hash string, used_at int64) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	for _, t := range s.refresh {
+		if t.Token_Hash == token_hash && t.Used_At == nil {
+			t.Used_At = &used_at
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// revoke session and every refresh token of it
+func (s *MemoryStore) RevokeRefreshSession(session_id string, revoked_at int64) error {
+	s.lock()
+	defer s.unlock()
+
+	s.revokeSessions(func(sess_id, _ string) bool { return sess_id == session_id }, revoked_at)
+
+	return nil
+}
+
+// revoke session and refresh token that match, must hold the lock
+func (s *MemoryStore) revokeSessions(match func(session_id, user_id string) bool, revoked_at int64) {
+	for _, sess := range s.sessions {
+		if match(sess.Session_ID, sess.User_ID) && sess.Revoked_At == nil {
+			sess.Revoked_At = &revoked_at
+		}
+	}
+
+	for _, t := range s.refresh {
+		if match(t.Session_ID, t.User_ID) && t.Revoked_At == nil {
+			t.Revoked_At = &revoked_at
+		}
+	}
+}
+
+// revoke every session and refresh token of user, used to log out everywhere
+func (s *MemoryStore) RevokeUserSessions(user_id string, revoked_at int64) error {
+	s.lock()
+	defer s.unlock()
+
+	s.revokeSessions(func(_, u_id string) bool { return u_id == user_id }, revoked_at)
+
+	return nil
+}
+
+// put access token jti into denylist until it expires
+func (s *MemoryStore) RevokeToken(jti string, expires_at int64) error {
+	s.lock()
+	defer s.unlock()
+
+	s.revoked[jti] = expires_at
+
+	return nil
+}
+
+// check access token is in denylist or the session is revoked
+func (s *MemoryStore) IsTokenRevoked(jti, session_id string) (bool, error) {
+	s.rlock()
+	defer s.runlock()
+
+	if _, ok := s.revoked[jti]; ok {
+		return true, nil
+	}
+
+	for _, sess := range s.sessions {
+		if sess.Session_ID == session_id && sess.Revoked_At != nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// delete expired denylist and sign in link
+func (s *MemoryStore) DeleteExpiredTokens(now int64) error {
+	s.lock()
+	defer s.unlock()
+
+	for jti, exp := range s.revoked {
+		if exp <= now {
+			delete(s.revoked, jti)
+		}
+	}
+
+	links := s.magic_links[:0]
+	for _, l := range s.magic_links {
+		if l.Expires_At > now {
+			links = append(links, l)
+		}
+	}
+	s.magic_links = links
+
+	return nil
+}
+
+// save new session
+func (s *MemoryStore) CreateSession(sess *SessionType) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.sessions {
+		if existing.Session_ID == sess.Session_ID {
+			return ConflictError("session id: %s already exists", sess.Session_ID)
+		}
+	}
+
+	c := *sess
+	s.sessions = append(s.sessions, &c)
+
+	return nil
+}
+
+// update last seen of session, at most once a minute
+func (s *MemoryStore) TouchSession(session_id string, now int64) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, sess := range s.sessions {
+		if sess.Session_ID == session_id && sess.Last_Seen_At < now-60 {
+			sess.Last_Seen_At = now
+		}
+	}
+
+	return nil
+}
+
+// get all active session of user, session whose refresh token is expired can not be used anymore
+func (s *MemoryStore) GetAllSessions(user_id string, now int64) ([]*SessionType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	active := map[string]bool{}
+	for _, t := range s.refresh {
+		if t.Revoked_At == nil && t.Expires_At > now {
+			active[t.Session_ID] = true
+		}
+	}
+
+	sessions := []*SessionType{}
+	for _, sess := range s.sessions {
+		if sess.User_ID == user_id && sess.Revoked_At == nil && active[sess.Session_ID] {
+			c := *sess
+			sessions = append(sessions, &c)
+		}
+	}
+
+	// same order as sql storage
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Last_Seen_At > sessions[j].Last_Seen_At
+	})
+
+	return sessions, nil
+}
+
+// revoke a session of user
+func (s *MemoryStore) RevokeSession(user_id, session_id string, revoked_at int64) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, sess := range s.sessions {
+		// session of other user is not found either, so the id can not be guessed
+		if sess.Session_ID == session_id && sess.User_ID == user_id && sess.Revoked_At == nil {
+			s.revokeSessions(func(sess_id, _ string) bool { return sess_id == session_id }, revoked_at)
+			return nil
+		}
+	}
+
+	return NotFoundError("session id: %s not found", session_id)
+}
+
+// put email into outbox
+func (s *MemoryStore) EnqueueEmail(msg *OutboxMessageType) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, m := range s.outbox {
+		if m.Outbox_ID == msg.Outbox_ID {
+			return ConflictError("data already exists")
+		}
+	}
+
+	c := *msg
+	s.outbox = append(s.outbox, &c)
+
+	return nil
+}
+
+// get pending email that is due to be sent, oldest first
+func (s *MemoryStore) GetDueEmails(now int64, limit int) ([]*OutboxMessageType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	messages := []*OutboxMessageType{}
+	for _, msg := range s.outbox {
+		if msg.Status == outboxPending && msg.Next_Attempt_At <= now {
+			c := *msg
+			messages = append(messages, &c)
+		}
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Next_Attempt_At < messages[j].Next_Attempt_At
+	})
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+// push next attempt of email to lease_until so other worker skip it,
+// false if other worker already claim it
+func (s *MemoryStore) ClaimEmail(outbox_id string, next_attempt_at, lease_until int64) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	for _, msg := range s.outbox {
+		if msg.Outbox_ID == outbox_id && msg.Status == outboxPending && msg.Next_Attempt_At == next_attempt_at {
+			msg.Next_Attempt_At = lease_until
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// mark email as sent, body is cleared so the sign in link is not kept
+func (s *MemoryStore) MarkEmailSent(outbox_id string, sent_at int64) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, msg := range s.outbox {
+		if msg.Outbox_ID == outbox_id {
+			msg.Status = outboxSent
+			msg.Attempts++
+			msg.Last_Error = nil
+			msg.HTML_Body = ""
+			msg.Text_Body = ""
+			msg.Link = ""
+			msg.Sent_At = &sent_at
+		}
+	}
+
+	return nil
+}
+
+// save status, attempts, error and next attempt after sending fail
+func (s *MemoryStore) MarkEmailFailed(msg *OutboxMessageType) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, m := range s.outbox {
+		if m.Outbox_ID == msg.Outbox_ID {
+			m.Status = msg.Status
+			m.Attempts = msg.Attempts
+			m.Last_Error = msg.Last_Error
+			m.Next_Attempt_At = msg.Next_Attempt_At
+		}
+	}
+
+	return nil
+}
+
+// get email that failed at least once and not sent yet, newest first
+func (s *MemoryStore) GetFailedEmails() ([]*OutboxMessageType, error) {
+	s.rlock()
+	defer s.runlock()
+
+	messages := []*OutboxMessageType{}
+	for _, msg := range s.outbox {
+		if msg.Status != outboxSent && msg.Last_Error != nil {
+			c := *msg
+			messages = append(messages, &c)
+		}
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Created_At > messages[j].Created_At
+	})
+
+	return messages, nil
+}
@@ -1,31 +1,129 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
-// create JWT
-func CreateJWT(user_id string) (string, error) {
-	// declare expiration time with 24 hours
-	expirationTime := time.Now().Add(24 * time.Hour)
+type contextKey string
+
+// key to store the signed in user_id and token claims in request context
+const (
+	userIDKey contextKey = "user_id"
+	claimsKey contextKey = "claims"
+)
+
+// get user_id of the signed in user from request context
+func getUserID(r *http.Request) string {
+	user_id, _ := r.Context().Value(userIDKey).(string)
+	return user_id
+}
+
+// get access token claims of the signed in user from request context
+func getClaims(r *http.Request) *ClaimsType {
+	claims, _ := r.Context().Value(claimsKey).(*ClaimsType)
+	return claims
+}
+
+// type of token, session token can not be used as sign in link and the other way around
+const (
+	tokenTypeSession   = "session"
+	tokenTypeMagicLink = "magic_link"
+)
+
+// sign in link only valid for 15 minutes
+const magicLinkExpiry = 15 * time.Minute
+
+// cookie name for cookie mode
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	csrfTokenCookie    = "csrf_token"
+)
+
+// header that must repeat the csrf_token cookie when the token come from cookie
+const csrfHeader = "X-CSRF-Token"
+
+// lifetime of access token and refresh token, set from config at startup
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// create JWT access token of a session, role is read again on every refresh
+func CreateJWT(user_id, role, session_id string) (string, error) {
+	// declare expiration time, refresh token is used to get a new one
+	expirationTime := time.Now().Add(accessTokenTTL)
 
 	// declare jwt claims
 	claims := &ClaimsType{
-		User_ID: user_id,
+		User_ID:    user_id,
+		Token_Type: tokenTypeSession,
+		Session_ID: session_id,
+		Role:       role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
-	// declare token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return signJWT(claims)
+}
+
+// create JWT for sign in link, nonce is stored and can only be used once
+func CreateMagicLinkJWT(link *MagicLinkType) (string, error) {
+	claims := &ClaimsType{
+		User_ID:    link.User_ID,
+		Token_Type: tokenTypeMagicLink,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        link.Nonce,
+			ExpiresAt: jwt.NewNumericDate(time.Unix(link.Expires_At, 0)),
+		},
+	}
+
+	return signJWT(claims)
+}
+
+// random url safe token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	// create jwt string
-	tokenString, err := token.SignedString(jwtKey)
+// create random refresh token and the hash to store
+func newRefreshToken() (string, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func signJWT(claims *ClaimsType) (string, error) {
+	// create jwt string with the active key
+	tokenString, err := jwtKeys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -33,29 +131,97 @@ func CreateJWT(user_id string) (string, error) {
 	return tokenString, nil
 }
 
+// get token from "Bearer <token>" header, scheme is case insensitive
+func parseBearer(authHeader string) (string, error) {
+	if authHeader == "" {
+		return "", &AppError{Kind: KindUnauthorized, Code: "missing_token", Message: "no auth header"}
+	}
+
+	scheme, token, _ := strings.Cut(strings.TrimSpace(authHeader), " ")
+	token = strings.TrimSpace(token)
+
+	// other scheme is the same as no auth (RFC 6750 section 3.1)
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", &AppError{Kind: KindUnauthorized, Code: "missing_token", Message: "auth scheme must be Bearer"}
+	}
+
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", &AppError{Kind: KindBadRequest, Code: "invalid_request", Message: "invalid auth header"}
+	}
+
+	return token, nil
+}
+
+func invalidTokenError(format string, a ...any) *AppError {
+	err := UnauthorizedError(format, a...)
+	err.Code = "invalid_token"
+	return err
+}
+
+// classify error of jwt parsing
+func tokenError(err error) *AppError {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return invalidTokenError("expired token")
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return invalidTokenError("token not valid yet")
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrSignatureInvalid):
+		return invalidTokenError("Signature Invalid")
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return invalidTokenError("malformed token")
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		return invalidTokenError("token can not be verified")
+	default:
+		return invalidTokenError("token invalid")
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// browser send cookie on request from other site too, so request authenticated by cookie
+// must repeat the csrf_token cookie in X-CSRF-Token header, which other site can not set
+// with the right value (double submit)
+func checkCSRF(r *http.Request) error {
+	cookie, err := r.Cookie(csrfTokenCookie)
+	header := r.Header.Get(csrfHeader)
+
+	if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+		return &AppError{Kind: KindForbidden, Code: "csrf_failed", Message: "csrf token missing or invalid"}
+	}
+
+	return nil
+}
+
 // MIDDLEWARE TO HANDLE JWT VERIFICATION
-func WithJWTAuth(next http.Handler) http.Handler {
+func (s *APIServer) WithJWTAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
 		// get auth header
 		authHeader := r.Header.Get("Authorization")
 
-		// sanity check
-		if authHeader == "" {
-			WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "no auth header"})
-			return
+		// in cookie mode the token can also come from cookie
+		if authHeader == "" && s.config.Auth_Cookie.Enabled {
+			if cookie, err := r.Cookie(accessTokenCookie); err == nil {
+				authHeader = "Bearer " + cookie.Value
+
+				if !isSafeMethod(r.Method) {
+					if err := checkCSRF(r); err != nil {
+						WriteError(w, err)
+						return
+					}
+				}
+			}
 		}
 
-		// split the header space
-		headerParts := strings.Split(authHeader, " ")
-		if len(headerParts) != 2 {
-			WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "invalid auth header"})
+		tokenString, err := parseBearer(authHeader)
+		if err != nil {
+			WriteError(w, err)
 			return
 		}
 
-		tokenString := headerParts[1]
-
 		// init claims
 		claims := new(ClaimsType)
 
@@ -64,30 +230,105 @@ func WithJWTAuth(next http.Handler) http.Handler {
 		// if the token is invalid (if it has expired according to the expiry time we set on sign in),
 		// or if the signature does not match
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, claims, jwtKeys.KeyFunc)
 
 		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
-				WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "Signature Invalid"})
-				return
-			}
+			WriteError(w, tokenError(err))
+			return
+		}
 
-			if strings.HasPrefix(err.Error(), "token is expired by") {
-				WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "expired token"})
-				return
-			}
+		if !token.Valid || claims.Token_Type != tokenTypeSession {
+			WriteError(w, invalidTokenError("token invalid"))
+			return
+		}
+
+		// token is revoked by logout
+		revoked, err := s.store.IsTokenRevoked(claims.ID, claims.Session_ID)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
 
-			WriteJSON(w, http.StatusBadRequest, ApiError{Error: err.Error()})
+		if revoked {
+			WriteError(w, invalidTokenError("token revoked"))
 			return
 		}
 
-		if !token.Valid {
-			WriteJSON(w, http.StatusUnauthorized, ApiError{Error: "token invalid"})
+		if err := s.store.TouchSession(claims.Session_ID, time.Now().Unix()); err != nil {
+			WriteError(w, err)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// put the signed in user into request context
+		ctx := context.WithValue(r.Context(), userIDKey, claims.User_ID)
+		ctx = context.WithValue(ctx, claimsKey, claims)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// MIDDLEWARE TO PUT CLIENT IP INTO RemoteAddr, X-Forwarded-For and X-Real-IP can be set by anyone
+// so they are only read when the request come from a trusted proxy
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remote, err := netip.ParseAddrPort(r.RemoteAddr)
+			if err != nil || !isTrusted(remote.Addr()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// every proxy append the address it got the request from, so the client is the
+			// right most address that is not one of our proxy
+			var client string
+			if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+				hops := strings.Split(xff, ",")
+				for i := len(hops) - 1; i >= 0; i-- {
+					addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+					if err != nil {
+						break
+					}
+
+					client = addr.Unmap().String()
+					if !isTrusted(addr) {
+						break
+					}
+				}
+			} else if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+				client = addr.Unmap().String()
+			}
+
+			if client != "" {
+				r.RemoteAddr = client
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MIDDLEWARE TO ALLOW ONLY ROLE OR HIGHER, must be used after WithJWTAuth
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := getClaims(r)
+
+			// token created before role is added has no role
+			if claims == nil || roleRank[claims.Role] < roleRank[role] {
+				WriteError(w, ForbiddenError("%s role required", role))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+func TestRealIP(t *testing.T) {
+	cfg := &Config{Trusted_Proxies: []string{"10.0.0.0/8", "::1"}}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		realIP string
+		want   string
+	}{
+		{"direct client can not fake ip", "203.0.113.7:1234", "198.51.100.1", "198.51.100.2", "203.0.113.7:1234"},
+		{"trusted proxy forwarded for", "10.0.0.2:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"right most untrusted hop", "10.0.0.2:1234", "1.2.3.4, 198.51.100.1, 10.0.0.3", "", "198.51.100.1"},
+		{"every hop trusted", "10.0.0.2:1234", "10.0.0.4, 10.0.0.3", "", "10.0.0.4"},
+		{"trusted ipv6 proxy", "[::1]:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy real ip", "10.0.0.2:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"trusted proxy without header", "10.0.0.2:1234", "", "", "10.0.0.2:1234"},
+		{"garbage header", "10.0.0.2:1234", "not-an-ip", "", "10.0.0.2:1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(cfg.TrustedProxies())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Database.Driver = "memory"
+	cfg.Trusted_Proxies = []string{" 10.0.0.0/8 ", "", "192.168.1.1"}
+	cfg.normalize()
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cfg.TrustedProxies(); len(got) != 2 || got[1].Bits() != 32 {
+		t.Errorf("TrustedProxies got %v", got)
+	}
+
+	cfg.Trusted_Proxies = []string{"10.0.0.0/33"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("invalid cidr is accepted")
+	}
+}
+
+func TestParseBearer(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		token  string
+		code   string
+	}{
+		{"missing header", "", "", "missing_token"},
+		{"basic scheme", "Basic dXNlcjpwYXNz", "", "missing_token"},
+		{"token without scheme", "eyJhbGciOi", "", "missing_token"},
+		{"bearer", "Bearer abc.def.ghi", "abc.def.ghi", ""},
+		{"lowercase bearer", "bearer abc.def.ghi", "abc.def.ghi", ""},
+		{"extra spaces", "  Bearer    abc.def.ghi  ", "abc.def.ghi", ""},
+		{"scheme only", "Bearer", "", "invalid_request"},
+		{"scheme and space", "Bearer   ", "", "invalid_request"},
+		{"two tokens", "Bearer abc def", "", "invalid_request"},
+		{"tab inside token", "Bearer abc\tdef", "", "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := parseBearer(tt.header)
+
+			if tt.code == "" {
+				if err != nil || token != tt.token {
+					t.Fatalf("got %q, %v, want %q", token, err, tt.token)
+				}
+				return
+			}
+
+			var appErr *AppError
+			if !errors.As(err, &appErr) || appErr.Code != tt.code {
+				t.Fatalf("got %q, %v, want code %s", token, err, tt.code)
+			}
+		})
+	}
+}
+
+// sign session claims with any method and key, kid is the kid of the test key set
+func signTestToken(t *testing.T, method jwt.SigningMethod, key any, claims *ClaimsType) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "test"
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func sessionClaims(expiresAt time.Time) *ClaimsType {
+	return &ClaimsType{
+		User_ID:    uuid.New().String(),
+		Token_Type: tokenTypeSession,
+		Session_ID: uuid.New().String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+func TestTokenError(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	notBefore := sessionClaims(future)
+	notBefore.NotBefore = jwt.NewNumericDate(future)
+
+	unknownKid := jwt.NewWithClaims(jwt.SigningMethodHS256, sessionClaims(future))
+	unknownKid.Header["kid"] = "unknown"
+	unknownKidToken, err := unknownKid.SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		message string
+	}{
+		{"expired", signTestToken(t, jwt.SigningMethodHS256, []byte(testSecret), sessionClaims(time.Now().Add(-time.Minute))), "expired token"},
+		{"not valid yet", signTestToken(t, jwt.SigningMethodHS256, []byte(testSecret), notBefore), "token not valid yet"},
+		{"bad signature", signTestToken(t, jwt.SigningMethodHS256, []byte("other-secret-that-is-long-enough-for-hs256"), sessionClaims(future)), "Signature Invalid"},
+		{"wrong alg", signTestToken(t, jwt.SigningMethodHS384, []byte(testSecret), sessionClaims(future)), "token can not be verified"},
+		{"unknown kid", unknownKidToken, "token can not be verified"},
+		{"malformed", "abc.def", "malformed token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.ParseWithClaims(tt.token, new(ClaimsType), jwtKeys.KeyFunc)
+			if err == nil {
+				t.Fatal("token is valid")
+			}
+
+			appErr := tokenError(err)
+			if appErr.Kind != KindUnauthorized || appErr.Code != "invalid_token" || appErr.Message != tt.message {
+				t.Errorf("got %v %s %q, want invalid_token %q", appErr.Kind, appErr.Code, appErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestWWWAuthenticate(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *AppError
+		want string
+	}{
+		{"missing token", &AppError{Kind: KindUnauthorized, Code: "missing_token", Message: "no auth header"}, `Bearer realm="roadtrip"`},
+		{"invalid request", &AppError{Kind: KindBadRequest, Code: "invalid_request", Message: "invalid auth header"}, `Bearer realm="roadtrip", error="invalid_request", error_description="invalid auth header"`},
+		{"invalid token", invalidTokenError("expired token"), `Bearer realm="roadtrip", error="invalid_token", error_description="expired token"`},
+		{"description is escaped", invalidTokenError("bad \"token\"\\\n"), `Bearer realm="roadtrip", error="invalid_token", error_description="bad token"`},
+		{"forbidden", ForbiddenError("admin role required"), ""},
+		{"not found", NotFoundError("not found"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wwwAuthenticate(tt.err); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// every auth failure of a protected route over http
+func TestWithJWTAuth(t *testing.T) {
+	ts := newTestServer(t)
+	access := ts.signUp(t, "Alice", "alice@example.com")
+	revoked := ts.signUp(t, "Bob", "bob@example.com")
+
+	if status := ts.request(t, "POST", "/logout", revoked, nil, nil); status != http.StatusOK {
+		t.Fatalf("logout: status %d", status)
+	}
+
+	acc, err := ts.store.CheckEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	magicLink, err := CreateMagicLinkJWT(&MagicLinkType{Nonce: uuid.New().String(), User_ID: acc.User_ID, Expires_At: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := signTestToken(t, jwt.SigningMethodHS256, []byte(testSecret), sessionClaims(time.Now().Add(-time.Minute)))
+	badSignature := signTestToken(t, jwt.SigningMethodHS256, []byte("other-secret-that-is-long-enough-for-hs256"), sessionClaims(time.Now().Add(time.Hour)))
+	wrongAlg := signTestToken(t, jwt.SigningMethodHS512, []byte(testSecret), sessionClaims(time.Now().Add(time.Hour)))
+
+	tests := []struct {
+		name    string
+		header  string
+		status  int
+		code    string
+		message string
+	}{
+		{"missing header", "", http.StatusUnauthorized, "missing_token", ""},
+		{"basic scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "missing_token", ""},
+		{"lowercase bearer", "bearer " + access, http.StatusOK, "", ""},
+		{"extra spaces", "Bearer   " + access + "  ", http.StatusOK, "", ""},
+		{"two tokens", "Bearer " + access + " " + access, http.StatusBadRequest, "invalid_request", "invalid auth header"},
+		{"expired", "Bearer " + expired, http.StatusUnauthorized, "invalid_token", "expired token"},
+		{"bad signature", "Bearer " + badSignature, http.StatusUnauthorized, "invalid_token", "Signature Invalid"},
+		{"wrong alg", "Bearer " + wrongAlg, http.StatusUnauthorized, "invalid_token", "token can not be verified"},
+		{"magic link as session", "Bearer " + magicLink, http.StatusUnauthorized, "invalid_token", "token invalid"},
+		{"revoked", "Bearer " + revoked, http.StatusUnauthorized, "invalid_token", "token revoked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+"/bookmark", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			res, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", res.StatusCode, tt.status)
+			}
+
+			if tt.status == http.StatusOK {
+				return
+			}
+
+			var body ApiError
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if body.Code != tt.code || (tt.message != "" && body.Error != tt.message) {
+				t.Errorf("got %s %q, want %s %q", body.Code, body.Error, tt.code, tt.message)
+			}
+
+			want := wwwAuthenticate(&AppError{Kind: KindUnauthorized, Code: tt.code, Message: body.Error})
+			if got := res.Header.Get("WWW-Authenticate"); got != want {
+				t.Errorf("WWW-Authenticate %q, want %q", got, want)
+			}
+		})
+	}
+}
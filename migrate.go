@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations
+var migrationFS embed.FS
+
+type Migrator interface {
+	MigrateUp() error
+	MigrateDown(steps int) error
+	MigrationStatus() ([]*MigrationStatusType, error)
+}
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// read migrations/<dialect>/NNNN_name.up.sql and NNNN_name.down.sql
+func loadMigrations(dialect string) ([]*migration, error) {
+	dir := "migrations/" + dialect
+
+	files, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, file := range files {
+		name := file.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, title, _ := strings.Cut(base, "_")
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration: %s invalid version", name)
+		}
+
+		content, err := fs.ReadFile(migrationFS, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: title}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := []*migration{}
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// split sql file into single statements, driver only run one at a time
+func splitStatements(content string) []string {
+	statements := []string{}
+	for _, stmt := range strings.Split(content, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+
+	return statements
+}
+
+// create schema_migrations table
+func (s *MysqlStore) createTableMigration() error {
+	createTable := `
+		create table if not exists schema_migrations (
+			version int not null,
+			name varchar(100) not null,
+			applied_at timestamp not null default current_timestamp,
+			primary key(version)
+		);
+	`
+	_, err := s.exec(createTable)
+
+	return err
+}
+
+// get version of migrations that already run
+func (s *MysqlStore) appliedMigrations() (map[int]string, error) {
+	rows, err := s.query("select version, applied_at from schema_migrations;")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var appliedAt string
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (s *MysqlStore) runStatements(content string) error {
+	for _, stmt := range splitStatements(content) {
+		if _, err := s.runner().Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run statements of a migration and record it in schema_migrations.
+// sqlite and postgres do both in one transaction so a failed migration leave nothing behind.
+// mysql commit every DDL statement implicitly and can not roll it back, a failed mysql
+// migration keep the statements before the failure and must be cleaned up by hand
+func (s *MysqlStore) applyMigration(content, record string, args ...any) error {
+	apply := func(tx *MysqlStore) error {
+		if err := tx.runStatements(content); err != nil {
+			return err
+		}
+
+		_, err := tx.exec(record, args...)
+		return err
+	}
+
+	if s.dialect == "mysql" {
+		return apply(s)
+	}
+
+	ctx := context.Background()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// sqlite ignore "pragma foreign_keys" inside transaction, so foreign key is turned off
+	// on the connection while the table is rebuilt and checked before commit
+	if s.dialect == "sqlite" {
+		if _, err := conn.ExecContext(ctx, "pragma foreign_keys = off;"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "pragma foreign_keys = on;")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txStore := *s
+	txStore.tx = tx
+
+	err = apply(&txStore)
+	if err == nil && s.dialect == "sqlite" {
+		err = txStore.checkForeignKeys()
+	}
+
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Println("rollback:", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// fail if a sqlite row reference a missing row
+func (s *MysqlStore) checkForeignKeys() error {
+	rows, err := s.query("pragma foreign_key_check;")
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	if rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("foreign key check: row %d of %s reference missing %s", rowid.Int64, table, parent)
+	}
+
+	return rows.Err()
+}
+
+// run every migration that not run yet
+func (s *MysqlStore) MigrateUp() error {
+	if err := s.createTableMigration(); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		if err := s.applyMigration(m.up, "insert into schema_migrations(version, name) values (?, ?);", m.version, m.name); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+
+		log.Printf("migration %04d_%s applied", m.version, m.name)
+	}
+
+	return nil
+}
+
+// revert the last steps migrations
+func (s *MysqlStore) MigrateDown(steps int) error {
+	if err := s.createTableMigration(); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+
+		if err := s.applyMigration(m.down, "delete from schema_migrations where version = ?;", m.version); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+
+		log.Printf("migration %04d_%s reverted", m.version, m.name)
+		steps--
+	}
+
+	return nil
+}
+
+// list every migration and when it is applied
+func (s *MysqlStore) MigrationStatus() ([]*MigrationStatusType, error) {
+	if err := s.createTableMigration(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	status := []*MigrationStatusType{}
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.version]
+		status = append(status, &MigrationStatusType{
+			Version:    m.version,
+			Name:       m.name,
+			Applied:    ok,
+			Applied_At: appliedAt,
+		})
+	}
+
+	return status, nil
+}
+
+// handle command: migrate up|down [steps]|status
+func runMigrate(store Storage, args []string) error {
+	migrator, ok := store.(Migrator)
+	if !ok {
+		return fmt.Errorf("storage does not support migration")
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.MigrateUp()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("steps: %s invalid", args[1])
+			}
+			steps = n
+		}
+
+		return migrator.MigrateDown(steps)
+	case "status":
+		status, err := migrator.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + m.Applied_At
+			}
+
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, state)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// failed migration leave no table and no schema_migrations row
+func TestSqliteMigrationRollback(t *testing.T) {
+	s := newTestSqliteStore(t)
+
+	err := s.applyMigration("create table partial (id int); insert into missing_table values (1);", "insert into schema_migrations(version, name) values (?, ?);", 9999, "broken")
+	if err == nil {
+		t.Fatal("broken migration applied")
+	}
+
+	var n int
+	if err := s.db.QueryRow("select count(*) from sqlite_master where name = 'partial';").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("table of failed migration is kept: %d, %v", n, err)
+	}
+
+	if err := s.db.QueryRow("select count(*) from schema_migrations where version = 9999;").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("failed migration is recorded: %d, %v", n, err)
+	}
+}
+
+// every sqlite migration can be reverted and applied again, data of the kept ones stay
+func TestSqliteMigrateDownUp(t *testing.T) {
+	s := newTestSqliteStore(t)
+
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MigrateDown(len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range status {
+		if m.Applied {
+			t.Errorf("migration %04d_%s still applied after down", m.Version, m.Name)
+		}
+	}
+
+	if err := s.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, des := mustDestination(t, s)
+
+	if err := s.MigrateDown(len(migrations) - 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetDestination(des.Destination_ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: "Nowhere", Destination_Lat: ptr(0.0), Destination_Long: ptr(0.0), City_ID: uuid.New().String()})
+	wantError(t, err, KindValidation, "invalid_reference")
+}
@@ -0,0 +1,6 @@
+drop table if exists user_save;
+drop table if exists bookmark;
+drop table if exists image;
+drop table if exists destination;
+drop table if exists city;
+drop table if exists user;
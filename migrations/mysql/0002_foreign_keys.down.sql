@@ -0,0 +1,12 @@
+alter table user_save drop foreign key fk_user_save_bookmark;
+alter table user_save drop foreign key fk_user_save_destination;
+alter table bookmark drop foreign key fk_bookmark_user;
+alter table image drop foreign key fk_image_destination;
+alter table destination drop foreign key fk_destination_city;
+
+alter table user_save drop index uq_user_save_bookmark_destination;
+
+drop index idx_user_save_destination_id on user_save;
+drop index idx_bookmark_user_id on bookmark;
+drop index idx_image_destination_id on image;
+drop index idx_destination_city_id on destination;
@@ -0,0 +1,22 @@
+-- email waiting to be sent by the outbox worker
+create table if not exists email_outbox (
+	outbox_id varchar(100),
+	recipient varchar(100) not null,
+	recipient_name varchar(100) not null,
+	subject varchar(255) not null,
+	html_body text not null,
+	text_body text not null,
+	-- sign in link of the email, given to mailer that expose it like the memory mailer
+	link varchar(1000) not null default '',
+	status varchar(20) not null,
+	attempts int not null default 0,
+	last_error varchar(1000),
+	next_attempt_at bigint not null,
+	created_at bigint not null,
+	-- email with a sign in link is useless after the link expire, null never expire
+	expires_at bigint,
+	sent_at bigint,
+	primary key(outbox_id)
+);
+
+create index idx_email_outbox_due on email_outbox(status, next_attempt_at);
@@ -0,0 +1,2 @@
+-- role of user: user, editor or admin
+alter table user add column role varchar(20) not null default 'user';
@@ -0,0 +1,45 @@
+create table if not exists "user" (
+	user_id varchar(100),
+	user_name varchar(100) not null,
+	email varchar(100) not null unique,
+	primary key(user_id)
+);
+
+create table if not exists city (
+	city_id varchar(100),
+	city_name varchar(50) not null unique,
+	city_lat numeric(10,7) not null,
+	city_long numeric(10,7) not null,
+	primary key(city_id)
+);
+
+create table if not exists destination (
+	destination_id varchar(100),
+	destination_name varchar(100),
+	destination_url varchar(200),
+	destination_lat numeric(10,7) not null,
+	destination_long numeric(10,7) not null,
+	city_id varchar(100) references city(city_id),
+	primary key(destination_id)
+);
+
+create table if not exists image (
+	image_id varchar(100),
+	image_url varchar(500) not null,
+	destination_id varchar(100) references destination(destination_id),
+	primary key(image_id)
+);
+
+create table if not exists bookmark (
+	bookmark_id varchar(100),
+	bookmark_name varchar(50) not null,
+	user_id varchar(100) references "user"(user_id),
+	primary key(bookmark_id)
+);
+
+create table if not exists user_save (
+	user_save_id varchar(100),
+	destination_id varchar(100) references destination(destination_id),
+	bookmark_id varchar(100) references bookmark(bookmark_id) on delete cascade,
+	primary key(user_save_id)
+);
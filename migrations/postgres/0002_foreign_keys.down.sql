@@ -0,0 +1,19 @@
+alter table user_save drop constraint fk_user_save_bookmark;
+alter table user_save drop constraint fk_user_save_destination;
+alter table bookmark drop constraint fk_bookmark_user;
+alter table image drop constraint fk_image_destination;
+alter table destination drop constraint fk_destination_city;
+
+alter table user_save drop constraint uq_user_save_bookmark_destination;
+
+drop index idx_user_save_destination_id;
+drop index idx_bookmark_user_id;
+drop index idx_image_destination_id;
+drop index idx_destination_city_id;
+
+-- put back the column references from 0001
+alter table destination add constraint destination_city_id_fkey foreign key (city_id) references city(city_id);
+alter table image add constraint image_destination_id_fkey foreign key (destination_id) references destination(destination_id);
+alter table bookmark add constraint bookmark_user_id_fkey foreign key (user_id) references "user"(user_id);
+alter table user_save add constraint user_save_destination_id_fkey foreign key (destination_id) references destination(destination_id);
+alter table user_save add constraint user_save_bookmark_id_fkey foreign key (bookmark_id) references bookmark(bookmark_id) on delete cascade;
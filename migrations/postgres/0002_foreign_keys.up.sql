@@ -0,0 +1,30 @@
+-- remove rows that point to missing data, otherwise the foreign keys can not be added
+delete from destination where city_id is not null and city_id not in (select city_id from city);
+delete from image where destination_id is not null and destination_id not in (select destination_id from destination);
+delete from bookmark where user_id is not null and user_id not in (select user_id from "user");
+delete from user_save where destination_id is not null and destination_id not in (select destination_id from destination);
+delete from user_save where bookmark_id is not null and bookmark_id not in (select bookmark_id from bookmark);
+
+-- keep only one save of the same destination in a bookmark
+delete from user_save u1 using user_save u2 where u1.bookmark_id = u2.bookmark_id and u1.destination_id = u2.destination_id and u1.user_save_id > u2.user_save_id;
+
+-- replace the column references from 0001 with named constraints
+alter table destination drop constraint if exists destination_city_id_fkey;
+alter table image drop constraint if exists image_destination_id_fkey;
+alter table bookmark drop constraint if exists bookmark_user_id_fkey;
+alter table user_save drop constraint if exists user_save_destination_id_fkey;
+alter table user_save drop constraint if exists user_save_bookmark_id_fkey;
+
+create index idx_destination_city_id on destination(city_id);
+create index idx_image_destination_id on image(destination_id);
+create index idx_bookmark_user_id on bookmark(user_id);
+create index idx_user_save_destination_id on user_save(destination_id);
+
+-- the unique key also serve as index of user_save.bookmark_id
+alter table user_save add constraint uq_user_save_bookmark_destination unique (bookmark_id, destination_id);
+
+alter table destination add constraint fk_destination_city foreign key (city_id) references city(city_id) on delete cascade;
+alter table image add constraint fk_image_destination foreign key (destination_id) references destination(destination_id) on delete cascade;
+alter table bookmark add constraint fk_bookmark_user foreign key (user_id) references "user"(user_id) on delete cascade;
+alter table user_save add constraint fk_user_save_destination foreign key (destination_id) references destination(destination_id) on delete cascade;
+alter table user_save add constraint fk_user_save_bookmark foreign key (bookmark_id) references bookmark(bookmark_id) on delete cascade;
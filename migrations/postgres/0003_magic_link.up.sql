@@ -0,0 +1,11 @@
+-- nonce of sign in link, a link can only be used once
+create table if not exists magic_link (
+	nonce varchar(100),
+	user_id varchar(100) not null,
+	expires_at bigint not null,
+	used_at bigint,
+	primary key(nonce),
+	constraint fk_magic_link_user foreign key (user_id) references "user"(user_id) on delete cascade
+);
+
+create index idx_magic_link_user_id on magic_link(user_id);
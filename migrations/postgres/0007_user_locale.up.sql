@@ -0,0 +1,2 @@
+-- preferred language of email, empty use Accept-Language of the request
+alter table "user" add column locale varchar(10) not null default '';
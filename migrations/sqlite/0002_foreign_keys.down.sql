@@ -0,0 +1,47 @@
+-- rebuild every table with the column references from 0001
+pragma foreign_keys = off;
+
+create table user_save_old (
+	user_save_id varchar(100),
+	destination_id varchar(100) references destination(destination_id),
+	bookmark_id varchar(100) references bookmark(bookmark_id) on delete cascade,
+	primary key(user_save_id)
+);
+insert into user_save_old select * from user_save;
+drop table user_save;
+alter table user_save_old rename to user_save;
+
+create table bookmark_old (
+	bookmark_id varchar(100),
+	bookmark_name varchar(50) not null,
+	user_id varchar(100) references user(user_id),
+	primary key(bookmark_id)
+);
+insert into bookmark_old select * from bookmark;
+drop table bookmark;
+alter table bookmark_old rename to bookmark;
+
+create table image_old (
+	image_id varchar(100),
+	image_url varchar(500) not null,
+	destination_id varchar(100) references destination(destination_id),
+	primary key(image_id)
+);
+insert into image_old select * from image;
+drop table image;
+alter table image_old rename to image;
+
+create table destination_old (
+	destination_id varchar(100),
+	destination_name varchar(100),
+	destination_url varchar(200),
+	destination_lat decimal(10,7) not null,
+	destination_long decimal(10,7) not null,
+	city_id varchar(100) references city(city_id),
+	primary key(destination_id)
+);
+insert into destination_old select * from destination;
+drop table destination;
+alter table destination_old rename to destination;
+
+pragma foreign_keys = on;
@@ -0,0 +1,59 @@
+-- sqlite can not add constraint to existing table, so every table is rebuilt
+pragma foreign_keys = off;
+
+create table destination_new (
+	destination_id varchar(100),
+	destination_name varchar(100),
+	destination_url varchar(200),
+	destination_lat decimal(10,7) not null,
+	destination_long decimal(10,7) not null,
+	city_id varchar(100),
+	primary key(destination_id),
+	constraint fk_destination_city foreign key (city_id) references city(city_id) on delete cascade
+);
+insert into destination_new select * from destination where city_id is null or city_id in (select city_id from city);
+drop table destination;
+alter table destination_new rename to destination;
+
+create table image_new (
+	image_id varchar(100),
+	image_url varchar(500) not null,
+	destination_id varchar(100),
+	primary key(image_id),
+	constraint fk_image_destination foreign key (destination_id) references destination(destination_id) on delete cascade
+);
+insert into image_new select * from image where destination_id is null or destination_id in (select destination_id from destination);
+drop table image;
+alter table image_new rename to image;
+
+create table bookmark_new (
+	bookmark_id varchar(100),
+	bookmark_name varchar(50) not null,
+	user_id varchar(100),
+	primary key(bookmark_id),
+	constraint fk_bookmark_user foreign key (user_id) references user(user_id) on delete cascade
+);
+insert into bookmark_new select * from bookmark where user_id is null or user_id in (select user_id from user);
+drop table bookmark;
+alter table bookmark_new rename to bookmark;
+
+-- the unique key also serve as index of user_save.bookmark_id
+create table user_save_new (
+	user_save_id varchar(100),
+	destination_id varchar(100),
+	bookmark_id varchar(100),
+	primary key(user_save_id),
+	constraint uq_user_save_bookmark_destination unique (bookmark_id, destination_id),
+	constraint fk_user_save_destination foreign key (destination_id) references destination(destination_id) on delete cascade,
+	constraint fk_user_save_bookmark foreign key (bookmark_id) references bookmark(bookmark_id) on delete cascade
+);
+insert or ignore into user_save_new select * from user_save where (destination_id is null or destination_id in (select destination_id from destination)) and (bookmark_id is null or bookmark_id in (select bookmark_id from bookmark));
+drop table user_save;
+alter table user_save_new rename to user_save;
+
+create index idx_destination_city_id on destination(city_id);
+create index idx_image_destination_id on image(destination_id);
+create index idx_bookmark_user_id on bookmark(user_id);
+create index idx_user_save_destination_id on user_save(destination_id);
+
+pragma foreign_keys = on;
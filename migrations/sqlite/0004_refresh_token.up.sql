@@ -0,0 +1,14 @@
+-- refresh token is stored as sha256 hash, every token of a session share session_id
+create table if not exists refresh_token (
+	token_hash varchar(100),
+	session_id varchar(100) not null,
+	user_id varchar(100) not null,
+	expires_at bigint not null,
+	used_at bigint,
+	revoked_at bigint,
+	primary key(token_hash),
+	constraint fk_refresh_token_user foreign key (user_id) references user(user_id) on delete cascade
+);
+
+create index idx_refresh_token_session_id on refresh_token(session_id);
+create index idx_refresh_token_user_id on refresh_token(user_id);
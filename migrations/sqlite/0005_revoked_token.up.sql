@@ -0,0 +1,8 @@
+-- denylist of access token jti, row can be deleted after the token expires
+create table if not exists revoked_token (
+	jti varchar(100),
+	expires_at bigint not null,
+	primary key(jti)
+);
+
+create index idx_revoked_token_expires_at on revoked_token(expires_at);
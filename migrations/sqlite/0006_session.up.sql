@@ -0,0 +1,18 @@
+-- signed in session, one row for every sign in link used
+create table if not exists session (
+	session_id varchar(100),
+	user_id varchar(100) not null,
+	user_agent varchar(500) not null,
+	ip varchar(100) not null,
+	created_at bigint not null,
+	last_seen_at bigint not null,
+	revoked_at bigint,
+	primary key(session_id),
+	constraint fk_session_user foreign key (user_id) references user(user_id) on delete cascade
+);
+
+create index idx_session_user_id on session(user_id);
+
+-- session created before this table only known from refresh token
+insert into session(session_id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at)
+select session_id, min(user_id), '', '', 0, 0, max(revoked_at) from refresh_token group by session_id;
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+// migrated mysql store in its own database, skipped if MYSQL_TEST_DSN is not set.
+// the user of the dsn must be able to create and drop database
+func newTestMysqlStore(t *testing.T) *MysqlStore {
+	t.Helper()
+
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN not set")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	name := "test_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	if _, err := db.Exec("create database " + name); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer db.Close()
+
+		if _, err := db.Exec("drop database " + name); err != nil {
+			t.Error(err)
+		}
+	})
+
+	cfg.DBName = name
+
+	s, err := NewMysqlStore(cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestMysqlStore(t *testing.T) {
+	if os.Getenv("MYSQL_TEST_DSN") == "" {
+		t.Skip("MYSQL_TEST_DSN not set")
+	}
+
+	testStorage(t, func(t *testing.T) Storage {
+		return newTestMysqlStore(t)
+	})
+}
+
+// every mysql migration can be reverted and applied again
+func TestMysqlMigrateDownUp(t *testing.T) {
+	s := newTestMysqlStore(t)
+
+	migrations, err := loadMigrations("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MigrateDown(len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range status {
+		if m.Applied {
+			t.Errorf("migration %04d_%s still applied after down", m.Version, m.Name)
+		}
+	}
+
+	var tables int
+	if err := s.db.QueryRow("select count(*) from information_schema.tables where table_schema = database() and table_name <> 'schema_migrations';").Scan(&tables); err != nil || tables != 0 {
+		t.Fatalf("%d table left after down, %v", tables, err)
+	}
+
+	if err := s.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	// data of the first migration is kept while the later ones are reverted and applied again
+	_, des := mustDestination(t, s)
+
+	if err := s.MigrateDown(len(migrations) - 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetDestination(des.Destination_ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: "Nowhere", Destination_Lat: ptr(0.0), Destination_Long: ptr(0.0), City_ID: uuid.New().String()})
+	wantError(t, err, KindValidation, "invalid_reference")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// number of email read from outbox at once
+const outboxBatchSize = 20
+
+// how long a claimed email is hidden from other worker while it is sent
+const outboxLease = 5 * time.Minute
+
+// Mailer that only put email into outbox, the worker send it later
+type OutboxMailer struct {
+	store Storage
+	wake  chan struct{}
+}
+
+func (m *OutboxMailer) Send(msg *MailType) error {
+	now := time.Now().Unix()
+
+	var expiresAt *int64
+	if msg.Expires_At != 0 {
+		expiresAt = &msg.Expires_At
+	}
+
+	err := m.store.EnqueueEmail(&OutboxMessageType{
+		Outbox_ID:       uuid.New().String(),
+		To:              msg.To,
+		To_Name:         msg.To_Name,
+		Subject:         msg.Subject,
+		HTML_Body:       msg.HTML_Body,
+		Text_Body:       msg.Text_Body,
+		Link:            msg.Link,
+		Status:          outboxPending,
+		Next_Attempt_At: now,
+		Created_At:      now,
+		Expires_At:      expiresAt,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// tell the worker to send now instead of waiting for the next poll
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// send email in outbox with mailer, failed email is retried with exponential backoff
+// until maxAttempts then it is marked dead
+type OutboxWorker struct {
+	store       Storage
+	mailer      Mailer
+	wake        chan struct{}
+	interval    time.Duration
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// create outbox mailer and worker, email is dead after cfg.Max_Attempts and the delay
+// after the first failure is cfg.Retry_Delay, doubled every attempt
+func NewOutbox(store Storage, mailer Mailer, cfg MailConfig) (*OutboxMailer, *OutboxWorker) {
+	wake := make(chan struct{}, 1)
+
+	outbox := &OutboxMailer{store: store, wake: wake}
+	worker := &OutboxWorker{
+		store:       store,
+		mailer:      mailer,
+		wake:        wake,
+		interval:    5 * time.Second,
+		maxAttempts: cfg.Max_Attempts,
+		baseDelay:   cfg.Retry_Delay,
+		maxDelay:    time.Hour,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	return outbox, worker
+}
+
+func (w *OutboxWorker) Start() {
+	go w.run()
+}
+
+func (w *OutboxWorker) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			// drain email that is already due before exit
+			w.deliverDue()
+			return
+		case <-w.wake:
+			w.deliverDue()
+		case <-ticker.C:
+			w.deliverDue()
+		}
+	}
+}
+
+// stop the worker after it send every due email, or when ctx is done
+func (w *OutboxWorker) Shutdown(ctx context.Context) error {
+	close(w.stop)
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send every due email. a store error stop the pass, the email is tried again on the next
+// tick instead of reading the same full batch again and again
+func (w *OutboxWorker) deliverDue() {
+	for {
+		messages, err := w.store.GetDueEmails(time.Now().Unix(), outboxBatchSize)
+		if err != nil {
+			log.Println("1. deliverDue", err)
+			return
+		}
+
+		for _, msg := range messages {
+			if err := w.deliver(msg); err != nil {
+				log.Println("2. deliverDue", err)
+				return
+			}
+		}
+
+		if len(messages) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// send one email, a failed send is recorded on the email and only a store error is returned
+func (w *OutboxWorker) deliver(msg *OutboxMessageType) error {
+	now := time.Now()
+
+	claimed, err := w.store.ClaimEmail(msg.Outbox_ID, msg.Next_Attempt_At, now.Add(outboxLease).Unix())
+	if err != nil {
+		return err
+	}
+
+	if !claimed {
+		return nil
+	}
+
+	// link in the email can not be used anymore, do not send it
+	if msg.Expires_At != nil && now.Unix() >= *msg.Expires_At {
+		errMsg := "link expired before the email is sent"
+		msg.Status = outboxDead
+		msg.Last_Error = &errMsg
+		log.Printf("email %s to %s is dead: %s", msg.Outbox_ID, msg.To, errMsg)
+
+		return w.store.MarkEmailFailed(msg)
+	}
+
+	err = w.mailer.Send(&MailType{
+		To:        msg.To,
+		To_Name:   msg.To_Name,
+		Subject:   msg.Subject,
+		HTML_Body: msg.HTML_Body,
+		Text_Body: msg.Text_Body,
+		Link:      msg.Link,
+	})
+
+	if err == nil {
+		return w.store.MarkEmailSent(msg.Outbox_ID, time.Now().Unix())
+	}
+
+	errMsg := truncate(err.Error(), 1000)
+	msg.Attempts++
+	msg.Last_Error = &errMsg
+	msg.Next_Attempt_At = now.Add(w.backoff(msg.Attempts)).Unix()
+
+	// no retry after the link expire
+	expired := msg.Expires_At != nil && msg.Next_Attempt_At >= *msg.Expires_At
+
+	if msg.Attempts >= w.maxAttempts || expired {
+		msg.Status = outboxDead
+		log.Printf("email %s to %s is dead after %d attempts: %v", msg.Outbox_ID, msg.To, msg.Attempts, err)
+	} else {
+		log.Printf("email %s to %s failed, attempt %d: %v", msg.Outbox_ID, msg.To, msg.Attempts, err)
+	}
+
+	return w.store.MarkEmailFailed(msg)
+}
+
+// delay before next attempt, baseDelay doubled after every failure up to maxDelay
+func (w *OutboxWorker) backoff(attempts int) time.Duration {
+	delay := w.baseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= w.maxDelay {
+			return w.maxDelay
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOutboxKeepsLink(t *testing.T) {
+	store := NewMemoryStore()
+	mailer := NewMemoryMailer()
+
+	outbox, worker := NewOutbox(store, mailer, defaultConfig().Mail)
+
+	err := outbox.Send(&MailType{To: "dave@example.com", Subject: "sign in", Text_Body: "body", Link: "https://app.example.com/auth/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker.deliverDue()
+
+	msg, ok := mailer.LastMessage("dave@example.com")
+	if !ok {
+		t.Fatal("email not delivered")
+	}
+
+	if msg.Link != "https://app.example.com/auth/token" {
+		t.Errorf("link = %q", msg.Link)
+	}
+
+	// sent email does not keep the link
+	if store.outbox[0].Status != outboxSent || store.outbox[0].Link != "" {
+		t.Errorf("outbox row after send: status %s, link %q", store.outbox[0].Status, store.outbox[0].Link)
+	}
+}
+
+// mailer that always fail
+type failingMailer struct{}
+
+func (failingMailer) Send(msg *MailType) error {
+	return errors.New("smtp down")
+}
+
+func TestOutboxExpiredLink(t *testing.T) {
+	store := NewMemoryStore()
+	mailer := NewMemoryMailer()
+
+	outbox, worker := NewOutbox(store, mailer, defaultConfig().Mail)
+
+	err := outbox.Send(&MailType{To: "dave@example.com", Subject: "sign in", Link: "https://app.example.com/auth/token", Expires_At: time.Now().Add(-time.Second).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker.deliverDue()
+
+	if _, ok := mailer.LastMessage("dave@example.com"); ok {
+		t.Error("email with expired link is delivered")
+	}
+
+	if msg := store.outbox[0]; msg.Status != outboxDead || msg.Last_Error == nil {
+		t.Errorf("outbox row: status %s, last error %v", msg.Status, msg.Last_Error)
+	}
+}
+
+// failed email is not retried after its link expire even if attempts are left
+func TestOutboxRetryCappedByExpiry(t *testing.T) {
+	store := NewMemoryStore()
+
+	outbox, worker := NewOutbox(store, failingMailer{}, defaultConfig().Mail)
+
+	for _, expiresIn := range []time.Duration{time.Hour, 10 * time.Second} {
+		err := outbox.Send(&MailType{To: "dave@example.com", Subject: "sign in", Link: "https://app.example.com/auth/token", Expires_At: time.Now().Add(expiresIn).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	worker.deliverDue()
+
+	// first retry is after 30s, before the first link expire and after the second one
+	if store.outbox[0].Status != outboxPending || store.outbox[1].Status != outboxDead {
+		t.Errorf("status %s and %s, want pending and dead", store.outbox[0].Status, store.outbox[1].Status)
+	}
+
+	for _, msg := range store.outbox {
+		if msg.Attempts != 1 {
+			t.Errorf("email %s attempts %d, want 1", msg.Outbox_ID, msg.Attempts)
+		}
+	}
+}
+
+// store that can not claim an email
+type claimFailingStore struct {
+	*MemoryStore
+	claims int
+}
+
+func (s *claimFailingStore) ClaimEmail(outbox_id string, next_attempt_at, lease_until int64) (bool, error) {
+	s.claims++
+	return false, errors.New("database down")
+}
+
+// failed claim stop the pass instead of reading the same full batch again
+func TestOutboxClaimErrorStopPass(t *testing.T) {
+	store := &claimFailingStore{MemoryStore: NewMemoryStore()}
+	mailer := NewMemoryMailer()
+
+	outbox, worker := NewOutbox(store, mailer, defaultConfig().Mail)
+
+	for i := 0; i < outboxBatchSize*2; i++ {
+		if err := outbox.Send(&MailType{To: "dave@example.com", Subject: "sign in", Text_Body: "body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		worker.deliverDue()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deliverDue does not return when claim fail")
+	}
+
+	if store.claims != 1 {
+		t.Errorf("claims %d, want 1", store.claims)
+	}
+
+	if _, ok := mailer.LastMessage("dave@example.com"); ok {
+		t.Error("unclaimed email is delivered")
+	}
+}
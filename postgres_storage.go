@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// postgres storage, use the mysql queries with $n placeholder and "quoted" identifier
+type PostgresStore struct {
+	MysqlStore
+}
+
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	// open the connection of db
+	db, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	log.Println("database is running...")
+
+	return &PostgresStore{
+		MysqlStore: MysqlStore{db: db, dialect: "postgres", rebind: postgresRebind},
+	}, nil
+}
+
+// change ? into $1, $2, ... and `name` into "name"
+func postgresRebind(query string) string {
+	var b strings.Builder
+	n := 0
+
+	for _, c := range query {
+		switch c {
+		case '?':
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+		case '`':
+			b.WriteRune('"')
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
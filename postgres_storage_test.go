@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"select 1;", "select 1;"},
+		{"select * from city where city_id = ?;", "select * from city where city_id = $1;"},
+		{"insert into `user`(user_id, email) values (?, ?);", `insert into "user"(user_id, email) values ($1, $2);`},
+		{"update image set image_url = ?, destination_id = ? where image_id = ?;", "update image set image_url = $1, destination_id = $2 where image_id = $3;"},
+	}
+
+	for _, tt := range tests {
+		if got := postgresRebind(tt.query); got != tt.want {
+			t.Errorf("postgresRebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// migrated postgres store in its own schema, skipped if POSTGRES_TEST_DSN is not set
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := "test_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	if _, err := db.Exec("create schema " + schema); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer db.Close()
+
+		if _, err := db.Exec("drop schema " + schema + " cascade"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	s, err := NewPostgresStore(withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// add search_path to url or key=value dsn
+func withSearchPath(dsn, schema string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return dsn + " search_path=" + schema
+	}
+
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func TestPostgresStore(t *testing.T) {
+	if os.Getenv("POSTGRES_TEST_DSN") == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	testStorage(t, func(t *testing.T) Storage {
+		return newTestPostgresStore(t)
+	})
+}
+
+// lat and long are numeric in postgres, lib/pq return it as text
+func TestPostgresNumericScan(t *testing.T) {
+	s := newTestPostgresStore(t)
+
+	city, err := s.CreateNewCity(&CreateNewCityType{City_Name: "Bandung", City_Lat: ptr(-6.9174639), City_Long: ptr(107.6191228)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if city.City_Lat != -6.9174639 || city.City_Long != 107.6191228 {
+		t.Errorf("CreateNewCity got lat %v long %v", city.City_Lat, city.City_Long)
+	}
+
+	des, err := s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: "Kawah Putih", Destination_Lat: ptr(-7.1661), Destination_Long: ptr(107.4021), City_ID: city.City_ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CreateNewImage(&CreateNewImageType{Image_URL: "https://img.example.com/1.jpg", Destination_ID: des.Destination_ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.CheckCity("Bandung")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.City_Lat != -6.9174639 || found.City_Long != 107.6191228 {
+		t.Errorf("CheckCity got lat %v long %v", found.City_Lat, found.City_Long)
+	}
+
+	destinations, err := s.GetAllDestination(city.City_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(destinations) != 1 || destinations[0].Destination_Lat != -7.1661 || destinations[0].Destination_Long != 107.4021 {
+		t.Errorf("GetAllDestination got %+v", destinations)
+	}
+
+	got, err := s.GetDestination(des.Destination_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Destination_Lat != -7.1661 || got.Destination_Long != 107.4021 {
+		t.Errorf("GetDestination got lat %v long %v", got.Destination_Lat, got.Destination_Long)
+	}
+}
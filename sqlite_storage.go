@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlite storage, query is same as mysql and tables come from migrations/sqlite
+type SqliteStore struct {
+	MysqlStore
+}
+
+func NewSqliteStore(dsn string) (*SqliteStore, error) {
+	dsn = strings.TrimPrefix(dsn, "sqlite://")
+	if dsn == "" {
+		dsn = "roadtrip.db"
+	}
+
+	// foreign key is off by default in sqlite
+	if !strings.Contains(dsn, "_foreign_keys") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&_foreign_keys=on"
+		} else {
+			dsn += "?_foreign_keys=on"
+		}
+	}
+
+	// open the connection of db
+	db, err := sql.Open("sqlite3", dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite only allow one writer at a time
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	log.Println("database is running...")
+
+	return &SqliteStore{
+		MysqlStore: MysqlStore{db: db, dialect: "sqlite"},
+	}, nil
+}
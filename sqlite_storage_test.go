@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// migrated sqlite store in a temp file
+func newTestSqliteStore(t testing.TB) *SqliteStore {
+	t.Helper()
+
+	s, err := NewSqliteStore("sqlite://" + filepath.Join(t.TempDir(), "roadtrip.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestSqliteStore(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage {
+		return newTestSqliteStore(t)
+	})
+}
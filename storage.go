@@ -4,40 +4,103 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 )
 
 type Storage interface {
+	init() error
+	Close() error
+	WithTx(fn func(tx Storage) error) error
 	CheckEmail(email string) (*AccountType, error)
 	SignUp(acc *SignUpType) (*AccountType, error)
+	GetAccount(user_id string) (*AccountType, error)
+	UpdateUserLocale(user_id, locale string) error
+	UpdateUserRole(email, role string) (*AccountType, error)
 	CreateNewCity(city *CreateNewCityType) (*CityType, error)
 	CheckCity(c string) (*CityType, error)
 	CreateNewDestination(des *CreateNewDestinationType) (*DestinationType, error)
-	GetSingleImage(des_id string, d *AllDestinationType) (*AllDestinationType, error)
 	GetAllDestination(city_id string) ([]*AllDestinationType, error)
 	GetDestination(des_id string) (*DestinationType, error)
-	CreateNewImage(img *CreateNewImageType) error
+	CreateNewImage(img *CreateNewImageType) (*ImageType, error)
 	GetAllImages(des_id string) ([]*ImageType, error)
+	GetAllCities() ([]*CityType, error)
+	GetCity(city_id string) (*CityType, error)
+	UpdateCity(city_id string, city *CreateNewCityType) (*CityType, error)
+	DeleteCity(city_id string) error
+	GetDestinationsByCity(city_id string) ([]*DestinationType, error)
+	UpdateDestination(des_id string, des *CreateNewDestinationType) (*DestinationType, error)
+	DeleteDestination(des_id string) error
+	GetImage(image_id string) (*ImageType, error)
+	UpdateImage(image_id string, img *CreateNewImageType) (*ImageType, error)
+	DeleteImage(image_id string) error
 	CreateNewBookmark(book *NewBookmarkType) (*BookmarkType, error)
 	GetAllBookmark(user_id string) ([]*BookmarkType, error)
-	SaveBookmarkData(newSave *CreateNewUser_SaveType) error
-	GetSingleImageSave_User(des_id string, d *SendDataUser_SaveType) (*SendDataUser_SaveType, error)
-	GetAllDataByBookmark(bookmark_id string) ([]*SendDataUser_SaveType, error)
-	UpdateBookmarkName(bookmark_id string, name *UpdateBookmarkNameType) error
-	DeleteBookmark(bookmark_id string) error
-	DeleteBookmarkData(user_save_id string) error
+	SaveBookmarkData(user_id string, newSave *CreateNewUser_SaveType) error
+	GetAllDataByBookmark(user_id, bookmark_id string) ([]*SendDataUser_SaveType, error)
+	UpdateBookmarkName(user_id, bookmark_id string, name *UpdateBookmarkNameType) error
+	DeleteBookmark(user_id, bookmark_id string) error
+	DeleteBookmarkData(user_id, user_save_id string) error
+	SaveMagicLink(link *MagicLinkType) error
+	ConsumeMagicLink(nonce string) (*MagicLinkType, error)
+	SaveRefreshToken(token *RefreshTokenType) error
+	GetRefreshToken(token_hash string) (*RefreshTokenType, error)
+	UseRefreshToken(token_hash string, used_at int64) (bool, error)
+	RevokeRefreshSession(session_id string, revoked_at int64) error
+	RevokeUserSessions(user_id string, revoked_at int64) error
+	RevokeToken(jti string, expires_at int64) error
+	IsTokenRevoked(jti, session_id string) (bool, error)
+	DeleteExpiredTokens(now int64) error
+	CreateSession(sess *SessionType) error
+	TouchSession(session_id string, now int64) error
+	GetAllSessions(user_id string, now int64) ([]*SessionType, error)
+	RevokeSession(user_id, session_id string, revoked_at int64) error
+	EnqueueEmail(msg *OutboxMessageType) error
+	GetDueEmails(now int64, limit int) ([]*OutboxMessageType, error)
+	ClaimEmail(outbox_id string, next_attempt_at, lease_until int64) (bool, error)
+	MarkEmailSent(outbox_id string, sent_at int64) error
+	MarkEmailFailed(msg *OutboxMessageType) error
+	GetFailedEmails() ([]*OutboxMessageType, error)
 }
 
+// pick storage base on the driver (mysql, sqlite, postgres or memory)
+func NewStorage(cfg DatabaseConfig) (Storage, error) {
+	switch cfg.Driver {
+	case "", "mysql":
+		return NewMysqlStore(cfg.DSN)
+	case "sqlite":
+		return NewSqliteStore(cfg.DSN)
+	case "postgres":
+		return NewPostgresStore(cfg.DSN)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("storage driver: %s not supported", cfg.Driver)
+	}
+}
+
+// MysqlStore hold the sql queries shared by mysql, sqlite and postgres,
+// rebind is used to translate the query for other database
 type MysqlStore struct {
-	db *sql.DB
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect string
+	rebind  func(query string) string
+}
+
+// query runner, either the db or the running transaction
+type sqlRunner interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
-func NewMysqlStore() (*MysqlStore, error) {
+func NewMysqlStore(dsn string) (*MysqlStore, error) {
 	// open the connection of db
-	db, err := sql.Open("mysql", os.Getenv("DSN"))
+	db, err := sql.Open("mysql", dsn)
 
 	if err != nil {
 		return nil, err
@@ -50,143 +113,135 @@ func NewMysqlStore() (*MysqlStore, error) {
 	log.Println("database is running...")
 
 	return &MysqlStore{
-		db: db,
+		db:      db,
+		dialect: "mysql",
 	}, nil
 }
 
-// crete user tabel
-func (s *MysqlStore) CreateTableUser() error {
-	createTable := `
-		create table if not exists user (
-			user_id varchar(100),
-			user_name varchar(100) not null,
-			email varchar(100) not null unique,
-			primary key(user_id)
-		);
-	`
-
-	_, err := s.db.Exec(createTable)
+// create and update the tables
+func (s *MysqlStore) init() error {
+	return s.MigrateUp()
+}
 
-	return err
+func (s *MysqlStore) Close() error {
+	return s.db.Close()
 }
 
-// create table city
-func (s *MysqlStore) CreateTableCity() error {
-	createTable := `
-		create table if not exists city (
-			city_id varchar(100),
-			city_name varchar(50) not null unique,
-			city_lat decimal(10,7) not null,
-			city_long decimal(10,7) not null,
-			primary key(city_id)
-		);
-	`
-	_, err := s.db.Exec(createTable)
+func (s *MysqlStore) bind(query string) string {
+	if s.rebind == nil {
+		return query
+	}
 
-	return err
+	return s.rebind(query)
 }
 
-// create table destination
-func (s *MysqlStore) CreateTableDestination() error {
-	createTable := `
-		create table if not exists destination (
-			destination_id varchar(100),
-			destination_name varchar(100),
-			destination_url varchar(200),
-			destination_lat decimal(10,7) not null,
-			destination_long decimal(10,7) not null,
-			city_id varchar(100) references city(city_id),
-			primary key(destination_id)
-		);
-	`
+func (s *MysqlStore) runner() sqlRunner {
+	if s.tx != nil {
+		return s.tx
+	}
 
-	_, err := s.db.Exec(createTable)
+	return s.db
+}
 
-	return err
+func (s *MysqlStore) exec(query string, args ...any) (sql.Result, error) {
+	res, err := s.runner().Exec(s.bind(query), args...)
+	return res, sqlError(err)
 }
 
-// create image table
-func (s *MysqlStore) CreateTableImage() error {
-	createTable := `
-		create table if not exists image (
-			image_id varchar(100),
-			image_url varchar(500) not null,
-			destination_id varchar(100) references destination(destination_id),
-			primary key(image_id)
-		);
-	`
-	_, err := s.db.Exec(createTable)
+func (s *MysqlStore) query(query string, args ...any) (*sql.Rows, error) {
+	return s.runner().Query(s.bind(query), args...)
+}
 
-	return err
+func (s *MysqlStore) queryRow(query string, args ...any) *sql.Row {
+	return s.runner().QueryRow(s.bind(query), args...)
 }
 
-// create bookmark table
-func (s *MysqlStore) CreateTableBookmark() error {
-	createTable := `
-		create table if not exists bookmark (
-			bookmark_id varchar(100),
-			bookmark_name varchar(50) not null,
-			user_id varchar(100) references user(user_id),
-			primary key(bookmark_id)
-		);
-	`
-	_, err := s.db.Exec(createTable)
+// run fn inside a transaction, commit if fn success and rollback if not
+func (s *MysqlStore) WithTx(fn func(tx Storage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
 
-	return err
-}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
 
-// create user_save tabel
-func (s *MysqlStore) CreateTableUserSave() error {
-	craeteTable := `
-		create table if not exists user_save (
-			user_save_id varchar(100),
-			destination_id varchar(100) references destination(destination_id),
-			bookmark_id varchar(100) references bookmark(bookmark_id) on delete cascade,
-			primary key(user_save_id)
-		);
-	`
+	txStore := *s
+	txStore.tx = tx
 
-	_, err := s.db.Exec(craeteTable)
+	if err := fn(&txStore); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Println("rollback:", rbErr)
+		}
+		return err
+	}
 
-	return err
+	return tx.Commit()
 }
 
-func (s *MysqlStore) init() error {
+// check email
+func (s *MysqlStore) CheckEmail(email string) (*AccountType, error) {
+	email = normalizeEmail(email)
 
-	if err := s.CreateTableUser(); err != nil {
-		return err
+	// email is stored normalized, so the unique index of email is used
+	acc := new(AccountType)
+	err := s.queryRow("select user_id, user_name, email, locale, role from `user` where email = ?;", email).Scan(&acc.User_ID, &acc.User_Name, &acc.Email, &acc.Locale, &acc.Role)
+
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("account %s not found", email)
 	}
 
-	if err := s.CreateTableCity(); err != nil {
-		return err
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.CreateTableDestination(); err != nil {
-		return err
+	return acc, nil
+}
+
+// Sign Up
+func (s *MysqlStore) SignUp(acc *SignUpType) (*AccountType, error) {
+	account := new(AccountType)
+	email := normalizeEmail(acc.Email)
+
+	_, err := s.CheckEmail(email)
+	if err == nil {
+		return nil, ConflictError("email: %s already registered", email)
 	}
 
-	if err := s.CreateTableImage(); err != nil {
-		return err
+	if !IsErrorKind(err, KindNotFound) {
+		return nil, err
 	}
 
-	if err := s.CreateTableBookmark(); err != nil {
-		return err
+	id := uuid.New().String()
+
+	insertQuery := "insert into `user`(user_id, user_name, email, locale) values (?, ?, ?, ?);"
+
+	_, err = s.exec(insertQuery, id, strings.TrimSpace(acc.User_Name), email, acc.Locale)
+
+	// other request sign up with the same email at the same time
+	if IsErrorKind(err, KindConflict) {
+		return nil, ConflictError("email: %s already registered", email)
 	}
 
-	if err := s.CreateTableUserSave(); err != nil {
-		return err
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if err := s.queryRow("select user_id, user_name, email, locale, role from `user` where user_id = ?;", id).Scan(&account.User_ID, &account.User_Name, &account.Email, &account.Locale, &account.Role); err != nil {
+		return nil, err
+	}
+
+	return account, nil
 }
 
-// check email
-func (s *MysqlStore) CheckEmail(email string) (*AccountType, error) {
+// get account by id
+func (s *MysqlStore) GetAccount(user_id string) (*AccountType, error) {
 	acc := new(AccountType)
-	err := s.db.QueryRow(`select * from user where email = ?;`, email).Scan(&acc.User_ID, &acc.User_Name, &acc.Email)
+	err := s.queryRow("select user_id, user_name, email, locale, role from `user` where user_id = ?;", user_id).Scan(&acc.User_ID, &acc.User_Name, &acc.Email, &acc.Locale, &acc.Role)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("account %s not found", email)
+		return nil, NotFoundError("user %s not found", user_id)
 	}
 
 	if err != nil {
@@ -196,25 +251,39 @@ func (s *MysqlStore) CheckEmail(email string) (*AccountType, error) {
 	return acc, nil
 }
 
-// Sign Up
-func (s *MysqlStore) SignUp(acc *SignUpType) (*AccountType, error) {
-	account := new(AccountType)
+// change preferred email language of user
+func (s *MysqlStore) UpdateUserLocale(user_id, locale string) error {
+	res, err := s.exec("update `user` set locale = ? where user_id = ?;", locale, user_id)
 
-	id := uuid.New().String()
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
 
-	insertQuery := `insert into user(user_id, user_name, email) values (?, ?, ?);`
+	if n == 0 {
+		return NotFoundError("user %s not found", user_id)
+	}
 
-	_, err := s.db.Exec(insertQuery, id, acc.User_Name, acc.Email)
+	return nil
+}
 
+// change role of user found by email
+func (s *MysqlStore) UpdateUserRole(email, role string) (*AccountType, error) {
+	acc, err := s.CheckEmail(email)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.db.QueryRow(`select * from user where user_id = ?;`, id).Scan(&account.User_ID, &account.User_Name, &account.Email); err != nil {
+	if _, err := s.exec("update `user` set role = ? where user_id = ?;", role, acc.User_ID); err != nil {
 		return nil, err
 	}
 
-	return account, nil
+	acc.Role = role
+	return acc, nil
 }
 
 // create new city
@@ -225,13 +294,13 @@ func (s *MysqlStore) CreateNewCity(city *CreateNewCityType) (*CityType, error) {
 
 	insertQuery := `insert into city(city_id, city_name, city_lat, city_long) values (?, ?, ?, ?);`
 
-	_, err := s.db.Exec(insertQuery, id, city.City_Name, city.City_Lat, city.City_Long)
+	_, err := s.exec(insertQuery, id, city.City_Name, *city.City_Lat, *city.City_Long)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.db.QueryRow(`select * from city where city_id = ?;`, id).Scan(&newCity.City_ID, &newCity.City_Name, &newCity.City_Lat, &newCity.City_Long); err != nil {
+	if err := s.queryRow(`select * from city where city_id = ?;`, id).Scan(&newCity.City_ID, &newCity.City_Name, &newCity.City_Lat, &newCity.City_Long); err != nil {
 		return nil, err
 	}
 
@@ -242,10 +311,10 @@ func (s *MysqlStore) CreateNewCity(city *CreateNewCityType) (*CityType, error) {
 func (s *MysqlStore) CheckCity(c string) (*CityType, error) {
 	city := new(CityType)
 
-	err := s.db.QueryRow("select * from city where city_name = ?;", c).Scan(&city.City_ID, &city.City_Name, &city.City_Lat, &city.City_Long)
+	err := s.queryRow("select * from city where city_name = ?;", c).Scan(&city.City_ID, &city.City_Name, &city.City_Lat, &city.City_Long)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("city: %s not found", c)
+		return nil, NotFoundError("city: %s not found", c)
 	}
 
 	if err != nil {
@@ -263,37 +332,35 @@ func (s *MysqlStore) CreateNewDestination(des *CreateNewDestinationType) (*Desti
 
 	insertQuery := `insert into destination(destination_id, destination_name, destination_url, destination_lat, destination_long, city_id) values (?, ?, ?, ?, ?, ?);`
 
-	_, err := s.db.Exec(insertQuery, id, des.Destination_Name, des.Destination_URL, des.Destination_Lat, des.Destination_Long, des.City_ID)
+	_, err := s.exec(insertQuery, id, des.Destination_Name, des.Destination_URL, *des.Destination_Lat, *des.Destination_Long, des.City_ID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.db.QueryRow("select * from destination where destination_id = ?;", id).Scan(&newDes.Destination_ID, &newDes.Destination_Name, &newDes.Destination_URL, &newDes.Destination_Lat, &newDes.Destination_Long, &newDes.City_ID); err != nil {
+	if err := s.queryRow("select * from destination where destination_id = ?;", id).Scan(&newDes.Destination_ID, &newDes.Destination_Name, &newDes.Destination_URL, &newDes.Destination_Lat, &newDes.Destination_Long, &newDes.City_ID); err != nil {
 		return nil, err
 	}
 
 	return newDes, err
 }
 
-// get single image
-func (s *MysqlStore) GetSingleImage(des_id string, d *AllDestinationType) (*AllDestinationType, error) {
-	err := s.db.QueryRow("select image_url from image where destination_id = ?;", des_id).Scan(&d.Image_URL)
-
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("image id: %s not found", des_id)
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	return d, nil
-}
+// join cover image i of destination d. image has no position or upload time, so the cover
+// is the image with the smallest image_id. the id is a random uuid so the pick is arbitrary,
+// but it is stable and the memory store pick the same image
+const coverImageJoin = "left join image i on i.image_id = (select min(image_id) from image where image.destination_id = d.destination_id)"
 
 // if city is there get all destination data base on city
 func (s *MysqlStore) GetAllDestination(city_id string) ([]*AllDestinationType, error) {
-	rows, err := s.db.Query(`select destination_id, destination_name, destination_url, destination_lat, destination_long from destination where city_id = ?;`, city_id)
+	queryStr := `
+		select d.destination_id, d.destination_name, d.destination_url, d.destination_lat, d.destination_long, i.image_url
+		from destination d
+		` + coverImageJoin + `
+		where d.city_id = ?
+		order by d.destination_id;
+	`
+
+	rows, err := s.query(queryStr, city_id)
 
 	if err != nil {
 		return nil, err
@@ -305,12 +372,8 @@ func (s *MysqlStore) GetAllDestination(city_id string) ([]*AllDestinationType, e
 	for rows.Next() {
 		d := new(AllDestinationType)
 
-		if err := rows.Scan(&d.Destination_ID, &d.Destination_Name, &d.Destination_URL, &d.Destination_Lat, &d.Destination_Long); err != nil {
-			return nil, err
-		}
-
-		d, err := s.GetSingleImage(d.Destination_ID, d)
-		if err != nil {
+		// image_url is null if destination has no image
+		if err := rows.Scan(&d.Destination_ID, &d.Destination_Name, &d.Destination_URL, &d.Destination_Lat, &d.Destination_Long, &d.Image_URL); err != nil {
 			return nil, err
 		}
 
@@ -328,10 +391,10 @@ func (s *MysqlStore) GetAllDestination(city_id string) ([]*AllDestinationType, e
 func (s *MysqlStore) GetDestination(des_id string) (*DestinationType, error) {
 	destination := new(DestinationType)
 
-	err := s.db.QueryRow("select * from destination where destination_id = ?;", des_id).Scan(&destination.Destination_ID, &destination.Destination_Name, &destination.Destination_URL, &destination.Destination_Lat, &destination.Destination_Long, &destination.City_ID)
+	err := s.queryRow("select * from destination where destination_id = ?;", des_id).Scan(&destination.Destination_ID, &destination.Destination_Name, &destination.Destination_URL, &destination.Destination_Lat, &destination.Destination_Long, &destination.City_ID)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("destination id: %s not found", des_id)
+		return nil, NotFoundError("destination id: %s not found", des_id)
 	}
 
 	if err != nil {
@@ -342,23 +405,23 @@ func (s *MysqlStore) GetDestination(des_id string) (*DestinationType, error) {
 }
 
 // create new images
-func (s *MysqlStore) CreateNewImage(img *CreateNewImageType) error {
+func (s *MysqlStore) CreateNewImage(img *CreateNewImageType) (*ImageType, error) {
 	id := uuid.New().String()
 
 	insertQuery := `insert into image(image_id, image_url, destination_id) values (?, ?, ?);`
 
-	_, err := s.db.Exec(insertQuery, id, img.Image_URL, img.Destination_ID)
+	_, err := s.exec(insertQuery, id, img.Image_URL, img.Destination_ID)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return s.GetImage(id)
 }
 
 // get all Image
 func (s *MysqlStore) GetAllImages(des_id string) ([]*ImageType, error) {
-	rows, err := s.db.Query("select * from image where destination_id = ?;", des_id)
+	rows, err := s.query("select * from image where destination_id = ?;", des_id)
 
 	if err != nil {
 		return nil, err
@@ -384,6 +447,190 @@ func (s *MysqlStore) GetAllImages(des_id string) ([]*ImageType, error) {
 	return images, nil
 }
 
+// get all city sorted by name
+func (s *MysqlStore) GetAllCities() ([]*CityType, error) {
+	rows, err := s.query("select city_id, city_name, city_lat, city_long from city order by city_name;")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	cities := []*CityType{}
+	for rows.Next() {
+		c := new(CityType)
+
+		if err := rows.Scan(&c.City_ID, &c.City_Name, &c.City_Lat, &c.City_Long); err != nil {
+			return nil, err
+		}
+
+		cities = append(cities, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cities, nil
+}
+
+// get city by id
+func (s *MysqlStore) GetCity(city_id string) (*CityType, error) {
+	city := new(CityType)
+
+	err := s.queryRow("select city_id, city_name, city_lat, city_long from city where city_id = ?;", city_id).Scan(&city.City_ID, &city.City_Name, &city.City_Lat, &city.City_Long)
+
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("city id: %s not found", city_id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return city, nil
+}
+
+// update city
+func (s *MysqlStore) UpdateCity(city_id string, city *CreateNewCityType) (*CityType, error) {
+	if _, err := s.GetCity(city_id); err != nil {
+		return nil, err
+	}
+
+	updateQuery := `update city set city_name = ?, city_lat = ?, city_long = ? where city_id = ?;`
+
+	if _, err := s.exec(updateQuery, city.City_Name, *city.City_Lat, *city.City_Long, city_id); err != nil {
+		return nil, err
+	}
+
+	return s.GetCity(city_id)
+}
+
+// delete city
+func (s *MysqlStore) DeleteCity(city_id string) error {
+	if _, err := s.GetCity(city_id); err != nil {
+		return err
+	}
+
+	// destination, image and user_save rows are deleted by the foreign key cascade
+	_, err := s.exec("delete from city where city_id = ?;", city_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// get all destination of city without cover image
+func (s *MysqlStore) GetDestinationsByCity(city_id string) ([]*DestinationType, error) {
+	if _, err := s.GetCity(city_id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query("select destination_id, destination_name, destination_url, destination_lat, destination_long, city_id from destination where city_id = ? order by destination_name;", city_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	destinations := []*DestinationType{}
+	for rows.Next() {
+		d := new(DestinationType)
+
+		if err := rows.Scan(&d.Destination_ID, &d.Destination_Name, &d.Destination_URL, &d.Destination_Lat, &d.Destination_Long, &d.City_ID); err != nil {
+			return nil, err
+		}
+
+		destinations = append(destinations, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return destinations, nil
+}
+
+// update destination
+func (s *MysqlStore) UpdateDestination(des_id string, des *CreateNewDestinationType) (*DestinationType, error) {
+	if _, err := s.GetDestination(des_id); err != nil {
+		return nil, err
+	}
+
+	updateQuery := `update destination set destination_name = ?, destination_url = ?, destination_lat = ?, destination_long = ?, city_id = ? where destination_id = ?;`
+
+	if _, err := s.exec(updateQuery, des.Destination_Name, des.Destination_URL, *des.Destination_Lat, *des.Destination_Long, des.City_ID, des_id); err != nil {
+		return nil, err
+	}
+
+	return s.GetDestination(des_id)
+}
+
+// delete destination
+func (s *MysqlStore) DeleteDestination(des_id string) error {
+	if _, err := s.GetDestination(des_id); err != nil {
+		return err
+	}
+
+	// image and user_save rows are deleted by the foreign key cascade
+	_, err := s.exec("delete from destination where destination_id = ?;", des_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// get image by id
+func (s *MysqlStore) GetImage(image_id string) (*ImageType, error) {
+	img := new(ImageType)
+
+	err := s.queryRow("select image_id, image_url, destination_id from image where image_id = ?;", image_id).Scan(&img.Image_ID, &img.Image_URL, &img.Destination_ID)
+
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("image id: %s not found", image_id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// update image
+func (s *MysqlStore) UpdateImage(image_id string, img *CreateNewImageType) (*ImageType, error) {
+	if _, err := s.GetImage(image_id); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.exec("update image set image_url = ?, destination_id = ? where image_id = ?;", img.Image_URL, img.Destination_ID, image_id); err != nil {
+		return nil, err
+	}
+
+	return s.GetImage(image_id)
+}
+
+// delete image
+func (s *MysqlStore) DeleteImage(image_id string) error {
+	if _, err := s.GetImage(image_id); err != nil {
+		return err
+	}
+
+	_, err := s.exec("delete from image where image_id = ?;", image_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // create new bookmark
 func (s *MysqlStore) CreateNewBookmark(book *NewBookmarkType) (*BookmarkType, error) {
 	newBook := new(BookmarkType)
@@ -391,13 +638,13 @@ func (s *MysqlStore) CreateNewBookmark(book *NewBookmarkType) (*BookmarkType, er
 
 	insertQuery := `insert into bookmark(bookmark_id, bookmark_name, user_id) values (?, ?, ?);`
 
-	_, err := s.db.Exec(insertQuery, id, book.Bookmark_Name, book.User_ID)
+	_, err := s.exec(insertQuery, id, book.Bookmark_Name, book.User_ID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.db.QueryRow("select * from bookmark where bookmark_id = ?;", id).Scan(&newBook.Bookmark_ID, &newBook.Bookmark_Name, &newBook.User_ID); err != nil {
+	if err := s.queryRow("select * from bookmark where bookmark_id = ?;", id).Scan(&newBook.Bookmark_ID, &newBook.Bookmark_Name, &newBook.User_ID); err != nil {
 		return nil, err
 	}
 
@@ -406,7 +653,7 @@ func (s *MysqlStore) CreateNewBookmark(book *NewBookmarkType) (*BookmarkType, er
 
 // get all bookmark
 func (s *MysqlStore) GetAllBookmark(user_id string) ([]*BookmarkType, error) {
-	rows, err := s.db.Query("select * from bookmark where user_id = ?;", user_id)
+	rows, err := s.query("select * from bookmark where user_id = ?;", user_id)
 
 	if err != nil {
 		return nil, err
@@ -432,12 +679,29 @@ func (s *MysqlStore) GetAllBookmark(user_id string) ([]*BookmarkType, error) {
 	return bookmarks, nil
 }
 
+// check the bookmark is there and belongs to user
+func (s *MysqlStore) checkBookmarkOwner(user_id, bookmark_id string) error {
+	var owner string
+	err := s.queryRow("select user_id from bookmark where bookmark_id = ?;", bookmark_id).Scan(&owner)
+
+	// bookmark of other user is not found either, so the id can not be guessed
+	if err == sql.ErrNoRows || (err == nil && owner != user_id) {
+		return NotFoundError("bookmark id: %s not found", bookmark_id)
+	}
+
+	return err
+}
+
 // save bookmark data
-func (s *MysqlStore) SaveBookmarkData(newSave *CreateNewUser_SaveType) error {
+func (s *MysqlStore) SaveBookmarkData(user_id string, newSave *CreateNewUser_SaveType) error {
+	if err := s.checkBookmarkOwner(user_id, newSave.Bookmark_ID); err != nil {
+		return err
+	}
+
 	id := uuid.New().String()
 	insertQuery := `insert into user_save(user_save_id, destination_id, bookmark_id) values(?, ?, ?);`
 
-	_, err := s.db.Exec(insertQuery, id, newSave.Destination_ID, newSave.Bookmark_ID)
+	_, err := s.exec(insertQuery, id, newSave.Destination_ID, newSave.Bookmark_ID)
 
 	if err != nil {
 		return err
@@ -446,42 +710,327 @@ func (s *MysqlStore) SaveBookmarkData(newSave *CreateNewUser_SaveType) error {
 	return nil
 }
 
-// get single image
-func (s *MysqlStore) GetSingleImageSave_User(des_id string, d *SendDataUser_SaveType) (*SendDataUser_SaveType, error) {
-	err := s.db.QueryRow("select image_url from image where destination_id = ?;", des_id).Scan(&d.Image_URL)
+// get all data from bookmark
+func (s *MysqlStore) GetAllDataByBookmark(user_id, bookmark_id string) ([]*SendDataUser_SaveType, error) {
+	if err := s.checkBookmarkOwner(user_id, bookmark_id); err != nil {
+		return nil, err
+	}
+
+	queryStr := `
+		select c.city_name, d.city_id, us.user_save_id, d.destination_id, d.destination_name, d.destination_url, i.image_url
+		from user_save us
+		inner join destination d on us.destination_id = d.destination_id
+		left join city c on d.city_id = c.city_id
+		` + coverImageJoin + `
+		where us.bookmark_id = ?
+		order by us.user_save_id;
+	`
+
+	rows, err := s.query(queryStr, bookmark_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	user_save_data := []*SendDataUser_SaveType{}
+	for rows.Next() {
+		u := new(SendDataUser_SaveType)
+		var city_name, city_id sql.NullString
+
+		// image_url is null if destination has no image
+		if err := rows.Scan(&city_name, &city_id, &u.User_Save_ID, &u.Destination_ID, &u.Destination_Name, &u.Destination_URL, &u.Image_URL); err != nil {
+			return nil, err
+		}
+
+		if !city_name.Valid {
+			return nil, NotFoundError("city: %s not found", city_id.String)
+		}
+
+		u.City_Name = city_name.String
+		u.City_ID = city_id.String
+		user_save_data = append(user_save_data, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return user_save_data, nil
+}
+
+// update bookmark name
+func (s *MysqlStore) UpdateBookmarkName(user_id, bookmark_id string, name *UpdateBookmarkNameType) error {
+	if err := s.checkBookmarkOwner(user_id, bookmark_id); err != nil {
+		return err
+	}
+
+	updateQuery := `update bookmark set bookmark_name = ? where bookmark_id = ?;`
+
+	_, err := s.exec(updateQuery, name.Bookmark_Name, bookmark_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// delete bookmark
+func (s *MysqlStore) DeleteBookmark(user_id, bookmark_id string) error {
+	if err := s.checkBookmarkOwner(user_id, bookmark_id); err != nil {
+		return err
+	}
+
+	// user_save rows is deleted by the foreign key cascade
+	_, err := s.exec("delete from bookmark where bookmark_id = ?;", bookmark_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// delete bookmark data
+func (s *MysqlStore) DeleteBookmarkData(user_id, user_save_id string) error {
+	var bookmark_id string
+	err := s.queryRow("select bookmark_id from user_save where user_save_id = ?;", user_save_id).Scan(&bookmark_id)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("image id: %s not found", des_id)
+		return NotFoundError("user save id: %s not found", user_save_id)
 	}
 
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkBookmarkOwner(user_id, bookmark_id); err != nil {
+		return err
+	}
+
+	_, err = s.exec("delete from user_save where user_save_id = ?", user_save_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// save nonce of sign in link
+func (s *MysqlStore) SaveMagicLink(link *MagicLinkType) error {
+	insertQuery := `insert into magic_link(nonce, user_id, expires_at) values (?, ?, ?);`
+
+	_, err := s.exec(insertQuery, link.Nonce, link.User_ID, link.Expires_At)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// mark sign in link as used, fail if it is already used or expired
+func (s *MysqlStore) ConsumeMagicLink(nonce string) (*MagicLinkType, error) {
+	link := new(MagicLinkType)
+	now := time.Now().Unix()
+
+	err := s.queryRow("select nonce, user_id, expires_at from magic_link where nonce = ?;", nonce).Scan(&link.Nonce, &link.User_ID, &link.Expires_At)
+
+	if err == sql.ErrNoRows {
+		return nil, UnauthorizedError("sign in link invalid")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if link.Expires_At <= now {
+		return nil, UnauthorizedError("sign in link expired")
+	}
+
+	// only one request can set used_at
+	res, err := s.exec("update magic_link set used_at = ? where nonce = ? and used_at is null;", now, nonce)
+
 	if err != nil {
 		return nil, err
 	}
 
-	return d, nil
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		return nil, UnauthorizedError("sign in link already used")
+	}
+
+	return link, nil
+}
+
+// save refresh token
+func (s *MysqlStore) SaveRefreshToken(token *RefreshTokenType) error {
+	insertQuery := `insert into refresh_token(token_hash, session_id, user_id, expires_at) values (?, ?, ?, ?);`
+
+	_, err := s.exec(insertQuery, token.Token_Hash, token.Session_ID, token.User_ID, token.Expires_At)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-// get city name
-func (s *MysqlStore) getCityName(city_id string, d *SendDataUser_SaveType) (*SendDataUser_SaveType, error) {
+// get refresh token by hash
+func (s *MysqlStore) GetRefreshToken(token_hash string) (*RefreshTokenType, error) {
+	token := new(RefreshTokenType)
 
-	err := s.db.QueryRow("select city_name from city where city_id = ?;", city_id).Scan(&d.City_Name)
+	err := s.queryRow("select token_hash, session_id, user_id, expires_at, used_at, revoked_at from refresh_token where token_hash = ?;", token_hash).Scan(&token.Token_Hash, &token.Session_ID, &token.User_ID, &token.Expires_At, &token.Used_At, &token.Revoked_At)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("city: %s not found", city_id)
+		return nil, UnauthorizedError("refresh token invalid")
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return d, nil
+	return token, nil
 }
 
-// get all data from bookmark
-func (s *MysqlStore) GetAllDataByBookmark(bookmark_id string) ([]*SendDataUser_SaveType, error) {
-	queryStr := "select user_save.user_save_id as `user_save_id`, destination.destination_id as `destination_id`, destination.destination_name as `destination_name`, destination.destination_url as `destination_url`, destination.city_id as `city_id` from user_save inner join destination on user_save.destination_id = destination.destination_id where user_save.bookmark_id = ?;"
+// mark refresh token as used, false if it is already used by other request
+func (s *MysqlStore) UseRefreshToken(token_hash string, used_at int64) (bool, error) {
+	res, err := s.exec("update refresh_token set used_at = ? where token_hash = ? and used_at is null;", used_at, token_hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// revoke session and every refresh token of it
+func (s *MysqlStore) RevokeRefreshSession(session_id string, revoked_at int64) error {
+	if _, err := s.exec("update session set revoked_at = ? where session_id = ? and revoked_at is null;", revoked_at, session_id); err != nil {
+		return err
+	}
+
+	_, err := s.exec("update refresh_token set revoked_at = ? where session_id = ? and revoked_at is null;", revoked_at, session_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// revoke every session and refresh token of user, used to log out everywhere
+func (s *MysqlStore) RevokeUserSessions(user_id string, revoked_at int64) error {
+	if _, err := s.exec("update session set revoked_at = ? where user_id = ? and revoked_at is null;", revoked_at, user_id); err != nil {
+		return err
+	}
+
+	_, err := s.exec("update refresh_token set revoked_at = ? where user_id = ? and revoked_at is null;", revoked_at, user_id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// put access token jti into denylist until it expires
+func (s *MysqlStore) RevokeToken(jti string, expires_at int64) error {
+	_, err := s.exec("insert into revoked_token(jti, expires_at) values (?, ?);", jti, expires_at)
+
+	// already revoked
+	if IsErrorKind(err, KindConflict) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// check access token is in denylist or the session is revoked
+func (s *MysqlStore) IsTokenRevoked(jti, session_id string) (bool, error) {
+	var n int
+
+	err := s.queryRow("select count(*) from revoked_token where jti = ?;", jti).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+
+	if n > 0 {
+		return true, nil
+	}
+
+	err = s.queryRow("select count(*) from session where session_id = ? and revoked_at is not null;", session_id).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// delete expired denylist and sign in link
+func (s *MysqlStore) DeleteExpiredTokens(now int64) error {
+	if _, err := s.exec("delete from revoked_token where expires_at <= ?;", now); err != nil {
+		return err
+	}
+
+	if _, err := s.exec("delete from magic_link where expires_at <= ?;", now); err != nil {
+		return err
+	}
+
+	return nil
+}
 
-	rows, err := s.db.Query(queryStr, bookmark_id)
+// save new session
+func (s *MysqlStore) CreateSession(sess *SessionType) error {
+	insertQuery := `insert into session(session_id, user_id, user_agent, ip, created_at, last_seen_at) values (?, ?, ?, ?, ?, ?);`
+
+	_, err := s.exec(insertQuery, sess.Session_ID, sess.User_ID, sess.User_Agent, sess.IP, sess.Created_At, sess.Last_Seen_At)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// update last seen of session, at most once a minute
+func (s *MysqlStore) TouchSession(session_id string, now int64) error {
+	_, err := s.exec("update session set last_seen_at = ? where session_id = ? and last_seen_at < ?;", now, session_id, now-60)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// get all active session of user, session whose refresh token is expired can not be used anymore
+func (s *MysqlStore) GetAllSessions(user_id string, now int64) ([]*SessionType, error) {
+	queryStr := `
+		select s.session_id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_seen_at
+		from session s
+		where s.user_id = ? and s.revoked_at is null
+		and exists (select 1 from refresh_token rt where rt.session_id = s.session_id and rt.revoked_at is null and rt.expires_at > ?)
+		order by s.last_seen_at desc;
+	`
+
+	rows, err := s.query(queryStr, user_id, now)
 
 	if err != nil {
 		return nil, err
@@ -489,42 +1038,46 @@ func (s *MysqlStore) GetAllDataByBookmark(bookmark_id string) ([]*SendDataUser_S
 
 	defer rows.Close()
 
-	user_save_data := []*SendDataUser_SaveType{}
+	sessions := []*SessionType{}
 	for rows.Next() {
-		u := new(SendDataUser_SaveType)
+		sess := new(SessionType)
 
-		if err := rows.Scan(&u.User_Save_ID, &u.Destination_ID, &u.Destination_Name, &u.Destination_URL, &u.City_ID); err != nil {
+		if err := rows.Scan(&sess.Session_ID, &sess.User_ID, &sess.User_Agent, &sess.IP, &sess.Created_At, &sess.Last_Seen_At); err != nil {
 			return nil, err
 		}
 
-		u, err := s.GetSingleImageSave_User(u.Destination_ID, u)
-
-		if err != nil {
-			return nil, err
-		}
+		sessions = append(sessions, sess)
+	}
 
-		u, err = s.getCityName(u.City_ID, u)
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	return sessions, nil
+}
 
-		user_save_data = append(user_save_data, u)
+// revoke a session of user
+func (s *MysqlStore) RevokeSession(user_id, session_id string, revoked_at int64) error {
+	var owner string
+	err := s.queryRow("select user_id from session where session_id = ? and revoked_at is null;", session_id).Scan(&owner)
 
+	// session of other user is not found either, so the id can not be guessed
+	if err == sql.ErrNoRows || (err == nil && owner != user_id) {
+		return NotFoundError("session id: %s not found", session_id)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	if err != nil {
+		return err
 	}
 
-	return user_save_data, nil
+	return s.RevokeRefreshSession(session_id, revoked_at)
 }
 
-// update bookmark name
-func (s *MysqlStore) UpdateBookmarkName(bookmark_id string, name *UpdateBookmarkNameType) error {
-	updateQuery := `update bookmark set bookmark_name = ? where bookmark_id = ?;`
+// put email into outbox
+func (s *MysqlStore) EnqueueEmail(msg *OutboxMessageType) error {
+	insertQuery := `insert into email_outbox(outbox_id, recipient, recipient_name, subject, html_body, text_body, link, status, attempts, next_attempt_at, created_at, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
-	_, err := s.db.Exec(updateQuery, name.Bookmark_Name, bookmark_id)
+	_, err := s.exec(insertQuery, msg.Outbox_ID, msg.To, msg.To_Name, msg.Subject, msg.HTML_Body, msg.Text_Body, msg.Link, msg.Status, msg.Attempts, msg.Next_Attempt_At, msg.Created_At, msg.Expires_At)
 
 	if err != nil {
 		return err
@@ -533,15 +1086,60 @@ func (s *MysqlStore) UpdateBookmarkName(bookmark_id string, name *UpdateBookmark
 	return nil
 }
 
-// delete bookmark
-func (s *MysqlStore) DeleteBookmark(bookmark_id string) error {
-	_, err := s.db.Exec("delete from user_save where bookmark_id = ?;", bookmark_id)
+const outboxColumns = "outbox_id, recipient, recipient_name, subject, html_body, text_body, link, status, attempts, last_error, next_attempt_at, created_at, expires_at, sent_at"
+
+func (s *MysqlStore) queryOutbox(query string, args ...any) ([]*OutboxMessageType, error) {
+	rows, err := s.query(query, args...)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = s.db.Exec("delete from bookmark where bookmark_id = ?;", bookmark_id)
+	defer rows.Close()
+
+	messages := []*OutboxMessageType{}
+	for rows.Next() {
+		msg := new(OutboxMessageType)
+
+		if err := rows.Scan(&msg.Outbox_ID, &msg.To, &msg.To_Name, &msg.Subject, &msg.HTML_Body, &msg.Text_Body, &msg.Link, &msg.Status, &msg.Attempts, &msg.Last_Error, &msg.Next_Attempt_At, &msg.Created_At, &msg.Expires_At, &msg.Sent_At); err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// get pending email that is due to be sent, oldest first
+func (s *MysqlStore) GetDueEmails(now int64, limit int) ([]*OutboxMessageType, error) {
+	return s.queryOutbox("select "+outboxColumns+" from email_outbox where status = ? and next_attempt_at <= ? order by next_attempt_at limit ?;", outboxPending, now, limit)
+}
+
+// push next attempt of email to lease_until so other worker skip it,
+// false if other worker already claim it
+func (s *MysqlStore) ClaimEmail(outbox_id string, next_attempt_at, lease_until int64) (bool, error) {
+	res, err := s.exec("update email_outbox set next_attempt_at = ? where outbox_id = ? and status = ? and next_attempt_at = ?;", lease_until, outbox_id, outboxPending, next_attempt_at)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// mark email as sent, body is cleared so the sign in link is not kept
+func (s *MysqlStore) MarkEmailSent(outbox_id string, sent_at int64) error {
+	_, err := s.exec("update email_outbox set status = ?, attempts = attempts + 1, last_error = null, html_body = '', text_body = '', link = '', sent_at = ? where outbox_id = ?;", outboxSent, sent_at, outbox_id)
 
 	if err != nil {
 		return err
@@ -550,9 +1148,9 @@ func (s *MysqlStore) DeleteBookmark(bookmark_id string) error {
 	return nil
 }
 
-// delete bookmark
-func (s *MysqlStore) DeleteBookmarkData(user_save_id string) error {
-	_, err := s.db.Exec("delete from user_save where user_save_id = ?", user_save_id)
+// save status, attempts, error and next attempt after sending fail
+func (s *MysqlStore) MarkEmailFailed(msg *OutboxMessageType) error {
+	_, err := s.exec("update email_outbox set status = ?, attempts = ?, last_error = ?, next_attempt_at = ? where outbox_id = ?;", msg.Status, msg.Attempts, msg.Last_Error, msg.Next_Attempt_At, msg.Outbox_ID)
 
 	if err != nil {
 		return err
@@ -560,3 +1158,8 @@ func (s *MysqlStore) DeleteBookmarkData(user_save_id string) error {
 
 	return nil
 }
+
+// get email that failed at least once and not sent yet, newest first
+func (s *MysqlStore) GetFailedEmails() ([]*OutboxMessageType, error) {
+	return s.queryOutbox("select "+outboxColumns+" from email_outbox where status <> ? and last_error is not null order by created_at desc;", outboxSent)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// number of statement sent to the counting sqlite driver
+var sqliteQueries atomic.Int64
+
+var registerCountingDriver sync.Once
+
+// sqlite driver that count every statement. the conn only has Prepare so database/sql
+// prepare every query and exec through it
+type countingDriver struct {
+	driver.Driver
+}
+
+func (d countingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return countingConn{conn}, nil
+}
+
+type countingConn struct {
+	driver.Conn
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	sqliteQueries.Add(1)
+	return c.Conn.Prepare(query)
+}
+
+// migrated sqlite store that count its queries
+func newCountingSqliteStore(tb testing.TB) *SqliteStore {
+	tb.Helper()
+
+	registerCountingDriver.Do(func() {
+		sql.Register("sqlite3_counting", countingDriver{&sqlite3.SQLiteDriver{}})
+	})
+
+	db, err := sql.Open("sqlite3_counting", filepath.Join(tb.TempDir(), "roadtrip.db")+"?_foreign_keys=on")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	tb.Cleanup(func() { db.Close() })
+
+	s := &SqliteStore{MysqlStore: MysqlStore{db: db, dialect: "sqlite"}}
+	if err := s.init(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return s
+}
+
+// city with n destination, every destination has two image and is saved in one bookmark
+func seedList(tb testing.TB, s Storage, n int) (city_id, user_id, bookmark_id string) {
+	tb.Helper()
+
+	acc := mustSignUp(tb, s, "Alice", "alice@example.com")
+
+	city, err := s.CreateNewCity(&CreateNewCityType{City_Name: "Bandung", City_Lat: ptr(-6.9), City_Long: ptr(107.6)})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	book, err := s.CreateNewBookmark(&NewBookmarkType{User_ID: acc.User_ID, Bookmark_Name: "trip"})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		des, err := s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: fmt.Sprintf("destination %d", i), Destination_Lat: ptr(-6.9), Destination_Long: ptr(107.6), City_ID: city.City_ID})
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		for j := 0; j < 2; j++ {
+			if _, err := s.CreateNewImage(&CreateNewImageType{Image_URL: fmt.Sprintf("https://img.example.com/%d-%d.jpg", i, j), Destination_ID: des.Destination_ID}); err != nil {
+				tb.Fatal(err)
+			}
+		}
+
+		if err := s.SaveBookmarkData(acc.User_ID, &CreateNewUser_SaveType{Destination_ID: des.Destination_ID, Bookmark_ID: book.Bookmark_ID}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return city.City_ID, acc.User_ID, book.Bookmark_ID
+}
+
+// queries of one call of fn
+func countQueries(tb testing.TB, fn func() error) int64 {
+	tb.Helper()
+
+	before := sqliteQueries.Load()
+	if err := fn(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return sqliteQueries.Load() - before
+}
+
+// list query must not run a query for every row
+func TestListQueryCount(t *testing.T) {
+	counts := map[int][2]int64{}
+
+	for _, n := range []int{1, 50} {
+		s := newCountingSqliteStore(t)
+		city_id, user_id, bookmark_id := seedList(t, s, n)
+
+		destinations := countQueries(t, func() error {
+			list, err := s.GetAllDestination(city_id)
+			if err == nil && len(list) != n {
+				err = fmt.Errorf("got %d destination, want %d", len(list), n)
+			}
+			return err
+		})
+
+		saved := countQueries(t, func() error {
+			list, err := s.GetAllDataByBookmark(user_id, bookmark_id)
+			if err == nil && len(list) != n {
+				err = fmt.Errorf("got %d saved destination, want %d", len(list), n)
+			}
+			return err
+		})
+
+		counts[n] = [2]int64{destinations, saved}
+	}
+
+	if counts[1] != counts[50] {
+		t.Errorf("query count grow with result size: 1 row %v, 50 rows %v", counts[1], counts[50])
+	}
+}
+
+func BenchmarkGetAllDestination(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("destinations=%d", n), func(b *testing.B) {
+			s := newCountingSqliteStore(b)
+			city_id, _, _ := seedList(b, s, n)
+
+			before := sqliteQueries.Load()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetAllDestination(city_id); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(sqliteQueries.Load()-before)/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func BenchmarkGetAllDataByBookmark(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("saved=%d", n), func(b *testing.B) {
+			s := newCountingSqliteStore(b)
+			_, user_id, bookmark_id := seedList(b, s, n)
+
+			before := sqliteQueries.Load()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetAllDataByBookmark(user_id, bookmark_id); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(sqliteQueries.Load()-before)/float64(b.N), "queries/op")
+		})
+	}
+}
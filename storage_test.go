@@ -0,0 +1,614 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// conformance suite run against every Storage, newStore return an empty store
+func testStorage(t *testing.T, newStore func(t *testing.T) Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Storage)
+	}{
+		{"Account", testStorageAccount},
+		{"Content", testStorageContent},
+		{"Cover", testStorageCover},
+		{"Bookmark", testStorageBookmark},
+		{"Tx", testStorageTx},
+		{"MagicLink", testStorageMagicLink},
+		{"Session", testStorageSession},
+		{"Outbox", testStorageOutbox},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage {
+		return NewMemoryStore()
+	})
+}
+
+// fail unless err is AppError of kind, code is only checked if not empty
+func wantError(t *testing.T, err error, kind ErrorKind, code string) {
+	t.Helper()
+
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("got error %v, want AppError kind %d", err, kind)
+	}
+
+	if appErr.Kind != kind || (code != "" && appErr.Code != code) {
+		t.Fatalf("got error kind %d code %q (%v), want kind %d code %q", appErr.Kind, appErr.Code, err, kind, code)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func mustSignUp(t testing.TB, s Storage, name, email string) *AccountType {
+	t.Helper()
+
+	acc, err := s.SignUp(&SignUpType{User_Name: name, Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return acc
+}
+
+// city with one destination that has one image
+func mustDestination(t testing.TB, s Storage) (*CityType, *DestinationType) {
+	t.Helper()
+
+	city, err := s.CreateNewCity(&CreateNewCityType{City_Name: "Bandung", City_Lat: ptr(-6.9), City_Long: ptr(107.6)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	des, err := s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: "Kawah Putih", Destination_Lat: ptr(-7.16), Destination_Long: ptr(107.4), City_ID: city.City_ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CreateNewImage(&CreateNewImageType{Image_URL: "https://img.example.com/1.jpg", Destination_ID: des.Destination_ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	return city, des
+}
+
+func testStorageAccount(t *testing.T, s Storage) {
+	acc := mustSignUp(t, s, "Alice", " Alice@Example.com ")
+
+	if acc.Email != "alice@example.com" || acc.Role != roleUser {
+		t.Errorf("sign up got email %q role %q", acc.Email, acc.Role)
+	}
+
+	_, err := s.SignUp(&SignUpType{User_Name: "Alice", Email: "ALICE@example.com"})
+	wantError(t, err, KindConflict, "")
+
+	found, err := s.CheckEmail("alice@EXAMPLE.com")
+	if err != nil || found.User_ID != acc.User_ID || found.User_Name != "Alice" {
+		t.Fatalf("CheckEmail got %v, %v", found, err)
+	}
+
+	_, err = s.CheckEmail("nobody@example.com")
+	wantError(t, err, KindNotFound, "")
+
+	if err := s.UpdateUserLocale(acc.User_ID, "id"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.UpdateUserRole("alice@example.com", roleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetAccount(acc.User_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Locale != "id" || got.Role != roleEditor {
+		t.Errorf("GetAccount got locale %q role %q", got.Locale, got.Role)
+	}
+
+	_, err = s.GetAccount(uuid.New().String())
+	wantError(t, err, KindNotFound, "")
+}
+
+func testStorageContent(t *testing.T, s Storage) {
+	city, des := mustDestination(t, s)
+
+	_, err := s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: "Nowhere", Destination_Lat: ptr(0.0), Destination_Long: ptr(0.0), City_ID: uuid.New().String()})
+	wantError(t, err, KindValidation, "invalid_reference")
+
+	_, err = s.CreateNewImage(&CreateNewImageType{Image_URL: "https://img.example.com/x.jpg", Destination_ID: uuid.New().String()})
+	wantError(t, err, KindValidation, "invalid_reference")
+
+	_, err = s.CreateNewCity(&CreateNewCityType{City_Name: "Bandung", City_Lat: ptr(-6.9), City_Long: ptr(107.6)})
+	wantError(t, err, KindConflict, "")
+
+	found, err := s.CheckCity("Bandung")
+	if err != nil || found.City_ID != city.City_ID {
+		t.Fatalf("CheckCity got %v, %v", found, err)
+	}
+
+	_, err = s.CheckCity("Jakarta")
+	wantError(t, err, KindNotFound, "")
+
+	updated, err := s.UpdateCity(city.City_ID, &CreateNewCityType{City_Name: "Bandung Raya", City_Lat: ptr(-6.9), City_Long: ptr(107.6)})
+	if err != nil || updated.City_Name != "Bandung Raya" {
+		t.Fatalf("UpdateCity got %v, %v", updated, err)
+	}
+
+	destinations, err := s.GetAllDestination(city.City_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(destinations) != 1 || destinations[0].Destination_ID != des.Destination_ID || destinations[0].Image_URL == nil || *destinations[0].Image_URL != "https://img.example.com/1.jpg" {
+		t.Fatalf("GetAllDestination got %+v", destinations)
+	}
+
+	got, err := s.GetDestination(des.Destination_ID)
+	if err != nil || got.Destination_Name != "Kawah Putih" || got.City_ID != city.City_ID {
+		t.Fatalf("GetDestination got %v, %v", got, err)
+	}
+
+	_, err = s.GetDestination(uuid.New().String())
+	wantError(t, err, KindNotFound, "")
+
+	images, err := s.GetAllImages(des.Destination_ID)
+	if err != nil || len(images) != 1 {
+		t.Fatalf("GetAllImages got %v, %v", images, err)
+	}
+
+	// both destination is saved in a bookmark
+	acc := mustSignUp(t, s, "Alice", "alice@example.com")
+
+	other, err := s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: "Tangkuban Perahu", Destination_Lat: ptr(-6.76), Destination_Long: ptr(107.6), City_ID: city.City_ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherImg, err := s.CreateNewImage(&CreateNewImageType{Image_URL: "https://img.example.com/2.jpg", Destination_ID: other.Destination_ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := s.CreateNewBookmark(&NewBookmarkType{User_ID: acc.User_ID, Bookmark_Name: "holiday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []*DestinationType{des, other} {
+		if err := s.SaveBookmarkData(acc.User_ID, &CreateNewUser_SaveType{Destination_ID: d.Destination_ID, Bookmark_ID: book.Bookmark_ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := func() []string {
+		t.Helper()
+
+		data, err := s.GetAllDataByBookmark(acc.User_ID, book.Bookmark_ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{}
+		for _, d := range data {
+			ids = append(ids, d.Destination_ID)
+		}
+
+		return ids
+	}
+
+	// destination is deleted with its image and user save
+	if err := s.DeleteDestination(other.Destination_ID); err != nil {
+		t.Fatal(err)
+	}
+
+	wantError(t, s.DeleteDestination(other.Destination_ID), KindNotFound, "")
+
+	_, err = s.GetImage(otherImg.Image_ID)
+	wantError(t, err, KindNotFound, "")
+
+	if ids := saved(); len(ids) != 1 || ids[0] != des.Destination_ID {
+		t.Fatalf("saved destination after DeleteDestination got %v, want only %s", ids, des.Destination_ID)
+	}
+
+	// city is deleted with its destination, image and user save
+	if err := s.DeleteCity(city.City_ID); err != nil {
+		t.Fatal(err)
+	}
+
+	wantError(t, s.DeleteCity(city.City_ID), KindNotFound, "")
+
+	_, err = s.GetCity(city.City_ID)
+	wantError(t, err, KindNotFound, "")
+
+	_, err = s.GetDestination(des.Destination_ID)
+	wantError(t, err, KindNotFound, "")
+
+	_, err = s.GetImage(images[0].Image_ID)
+	wantError(t, err, KindNotFound, "")
+
+	if ids := saved(); len(ids) != 0 {
+		t.Fatalf("saved destination after DeleteCity got %v, want none", ids)
+	}
+
+	// bookmark itself is kept
+	bookmarks, err := s.GetAllBookmark(acc.User_ID)
+	if err != nil || len(bookmarks) != 1 {
+		t.Fatalf("GetAllBookmark after DeleteCity got %v, %v", bookmarks, err)
+	}
+}
+
+// city where one destination has images and the other has none
+func mustMixedCity(t testing.TB, s Storage) (city *CityType, withImage, withoutImage *DestinationType, cover string) {
+	t.Helper()
+
+	city, withImage = mustDestination(t, s)
+
+	withoutImage, err := s.CreateNewDestination(&CreateNewDestinationType{Destination_Name: "Tangkuban Perahu", Destination_Lat: ptr(-6.76), Destination_Long: ptr(107.6), City_ID: city.City_ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CreateNewImage(&CreateNewImageType{Image_URL: "https://img.example.com/2.jpg", Destination_ID: withImage.Destination_ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := s.GetAllImages(withImage.Destination_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var coverID string
+	for _, img := range images {
+		if coverID == "" || img.Image_ID < coverID {
+			coverID, cover = img.Image_ID, img.Image_URL
+		}
+	}
+
+	return city, withImage, withoutImage, cover
+}
+
+func testStorageCover(t *testing.T, s Storage) {
+	acc := mustSignUp(t, s, "Alice", "alice@example.com")
+	city, withImage, withoutImage, cover := mustMixedCity(t, s)
+
+	destinations, err := s.GetAllDestination(city.City_ID)
+	if err != nil || len(destinations) != 2 {
+		t.Fatalf("GetAllDestination got %+v, %v", destinations, err)
+	}
+
+	book, err := s.CreateNewBookmark(&NewBookmarkType{User_ID: acc.User_ID, Bookmark_Name: "trip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, des := range []*DestinationType{withImage, withoutImage} {
+		if err := s.SaveBookmarkData(acc.User_ID, &CreateNewUser_SaveType{Destination_ID: des.Destination_ID, Bookmark_ID: book.Bookmark_ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := s.GetAllDataByBookmark(acc.User_ID, book.Bookmark_ID)
+	if err != nil || len(saved) != 2 {
+		t.Fatalf("GetAllDataByBookmark got %+v, %v", saved, err)
+	}
+
+	covers := map[string]*string{}
+	for _, d := range destinations {
+		covers["list "+d.Destination_ID] = d.Image_URL
+	}
+	for _, d := range saved {
+		covers["bookmark "+d.Destination_ID] = d.Image_URL
+	}
+
+	for _, from := range []string{"list ", "bookmark "} {
+		if got := covers[from+withImage.Destination_ID]; got == nil || *got != cover {
+			t.Errorf("%scover of destination with image = %v, want %s", from, got, cover)
+		}
+
+		if got := covers[from+withoutImage.Destination_ID]; got != nil {
+			t.Errorf("%scover of destination without image = %s, want null", from, *got)
+		}
+	}
+}
+
+func testStorageBookmark(t *testing.T, s Storage) {
+	alice := mustSignUp(t, s, "Alice", "alice@example.com")
+	bob := mustSignUp(t, s, "Bob", "bob@example.com")
+	_, des := mustDestination(t, s)
+
+	_, err := s.CreateNewBookmark(&NewBookmarkType{User_ID: uuid.New().String(), Bookmark_Name: "ghost"})
+	wantError(t, err, KindValidation, "invalid_reference")
+
+	book, err := s.CreateNewBookmark(&NewBookmarkType{User_ID: alice.User_ID, Bookmark_Name: "holiday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if book.User_ID != alice.User_ID || book.Bookmark_Name != "holiday" {
+		t.Errorf("CreateNewBookmark got %+v", book)
+	}
+
+	save := &CreateNewUser_SaveType{Destination_ID: des.Destination_ID, Bookmark_ID: book.Bookmark_ID}
+	if err := s.SaveBookmarkData(alice.User_ID, save); err != nil {
+		t.Fatal(err)
+	}
+
+	wantError(t, s.SaveBookmarkData(alice.User_ID, save), KindConflict, "")
+	wantError(t, s.SaveBookmarkData(bob.User_ID, save), KindNotFound, "")
+	wantError(t, s.SaveBookmarkData(alice.User_ID, &CreateNewUser_SaveType{Destination_ID: des.Destination_ID, Bookmark_ID: uuid.New().String()}), KindNotFound, "")
+	wantError(t, s.SaveBookmarkData(alice.User_ID, &CreateNewUser_SaveType{Destination_ID: uuid.New().String(), Bookmark_ID: book.Bookmark_ID}), KindValidation, "invalid_reference")
+
+	bookmarks, err := s.GetAllBookmark(bob.User_ID)
+	if err != nil || len(bookmarks) != 0 {
+		t.Fatalf("bob GetAllBookmark got %v, %v", bookmarks, err)
+	}
+
+	data, err := s.GetAllDataByBookmark(alice.User_ID, book.Bookmark_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != 1 || data[0].Destination_ID != des.Destination_ID || data[0].City_Name != "Bandung" || data[0].Image_URL == nil || *data[0].Image_URL != "https://img.example.com/1.jpg" {
+		t.Fatalf("GetAllDataByBookmark got %+v", data)
+	}
+
+	_, err = s.GetAllDataByBookmark(bob.User_ID, book.Bookmark_ID)
+	wantError(t, err, KindNotFound, "")
+
+	wantError(t, s.UpdateBookmarkName(bob.User_ID, book.Bookmark_ID, &UpdateBookmarkNameType{Bookmark_Name: "mine"}), KindNotFound, "")
+
+	if err := s.UpdateBookmarkName(alice.User_ID, book.Bookmark_ID, &UpdateBookmarkNameType{Bookmark_Name: "trip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantError(t, s.DeleteBookmarkData(bob.User_ID, data[0].User_Save_ID), KindNotFound, "")
+
+	if err := s.DeleteBookmarkData(alice.User_ID, data[0].User_Save_ID); err != nil {
+		t.Fatal(err)
+	}
+
+	wantError(t, s.DeleteBookmarkData(alice.User_ID, data[0].User_Save_ID), KindNotFound, "")
+
+	wantError(t, s.DeleteBookmark(bob.User_ID, book.Bookmark_ID), KindNotFound, "")
+
+	if err := s.DeleteBookmark(alice.User_ID, book.Bookmark_ID); err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks, err = s.GetAllBookmark(alice.User_ID)
+	if err != nil || len(bookmarks) != 0 {
+		t.Fatalf("alice GetAllBookmark after delete got %v, %v", bookmarks, err)
+	}
+}
+
+// bookmark created in a transaction is rolled back when saving into it fail
+func testStorageTx(t *testing.T, s Storage) {
+	acc := mustSignUp(t, s, "Alice", "alice@example.com")
+	_, des := mustDestination(t, s)
+
+	err := s.WithTx(func(tx Storage) error {
+		book, err := tx.CreateNewBookmark(&NewBookmarkType{User_ID: acc.User_ID, Bookmark_Name: "orphan"})
+		if err != nil {
+			return err
+		}
+
+		return tx.SaveBookmarkData(acc.User_ID, &CreateNewUser_SaveType{Destination_ID: uuid.New().String(), Bookmark_ID: book.Bookmark_ID})
+	})
+	wantError(t, err, KindValidation, "invalid_reference")
+
+	bookmarks, err := s.GetAllBookmark(acc.User_ID)
+	if err != nil || len(bookmarks) != 0 {
+		t.Fatalf("bookmark after rollback: %+v, %v", bookmarks, err)
+	}
+
+	// the same steps are committed when both success
+	err = s.WithTx(func(tx Storage) error {
+		book, err := tx.CreateNewBookmark(&NewBookmarkType{User_ID: acc.User_ID, Bookmark_Name: "trip"})
+		if err != nil {
+			return err
+		}
+
+		return tx.SaveBookmarkData(acc.User_ID, &CreateNewUser_SaveType{Destination_ID: des.Destination_ID, Bookmark_ID: book.Bookmark_ID})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks, err = s.GetAllBookmark(acc.User_ID)
+	if err != nil || len(bookmarks) != 1 {
+		t.Fatalf("bookmark after commit: %+v, %v", bookmarks, err)
+	}
+
+	data, err := s.GetAllDataByBookmark(acc.User_ID, bookmarks[0].Bookmark_ID)
+	if err != nil || len(data) != 1 {
+		t.Fatalf("saved data after commit: %+v, %v", data, err)
+	}
+}
+
+func testStorageMagicLink(t *testing.T, s Storage) {
+	acc := mustSignUp(t, s, "Alice", "alice@example.com")
+	now := time.Now()
+
+	link := &MagicLinkType{Nonce: uuid.New().String(), User_ID: acc.User_ID, Expires_At: now.Add(time.Minute).Unix()}
+	expired := &MagicLinkType{Nonce: uuid.New().String(), User_ID: acc.User_ID, Expires_At: now.Add(-time.Minute).Unix()}
+
+	for _, l := range []*MagicLinkType{link, expired} {
+		if err := s.SaveMagicLink(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.ConsumeMagicLink(link.Nonce)
+	if err != nil || got.User_ID != acc.User_ID {
+		t.Fatalf("ConsumeMagicLink got %v, %v", got, err)
+	}
+
+	_, err = s.ConsumeMagicLink(link.Nonce)
+	wantError(t, err, KindUnauthorized, "")
+
+	_, err = s.ConsumeMagicLink(expired.Nonce)
+	wantError(t, err, KindUnauthorized, "")
+
+	_, err = s.ConsumeMagicLink(uuid.New().String())
+	wantError(t, err, KindUnauthorized, "")
+}
+
+func testStorageSession(t *testing.T, s Storage) {
+	acc := mustSignUp(t, s, "Alice", "alice@example.com")
+	now := time.Now().Unix()
+
+	sessions := []*SessionType{
+		{Session_ID: uuid.New().String(), User_ID: acc.User_ID, User_Agent: "a", IP: "127.0.0.1", Created_At: now, Last_Seen_At: now},
+		{Session_ID: uuid.New().String(), User_ID: acc.User_ID, User_Agent: "b", IP: "127.0.0.1", Created_At: now, Last_Seen_At: now},
+	}
+
+	for _, sess := range sessions {
+		if err := s.CreateSession(sess); err != nil {
+			t.Fatal(err)
+		}
+
+		hash := hashToken(sess.Session_ID)
+		if err := s.SaveRefreshToken(&RefreshTokenType{Token_Hash: hash, Session_ID: sess.Session_ID, User_ID: acc.User_ID, Expires_At: now + 3600}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash := hashToken(sessions[0].Session_ID)
+
+	if ok, err := s.UseRefreshToken(hash, now); err != nil || !ok {
+		t.Fatalf("first UseRefreshToken got %v, %v", ok, err)
+	}
+
+	if ok, err := s.UseRefreshToken(hash, now); err != nil || ok {
+		t.Fatalf("second UseRefreshToken got %v, %v", ok, err)
+	}
+
+	active, err := s.GetAllSessions(acc.User_ID, now)
+	if err != nil || len(active) != 2 {
+		t.Fatalf("GetAllSessions got %d, %v", len(active), err)
+	}
+
+	// session whose refresh token is expired is not listed
+	expired := &SessionType{Session_ID: uuid.New().String(), User_ID: acc.User_ID, User_Agent: "c", IP: "127.0.0.1", Created_At: now - 7200, Last_Seen_At: now - 7200}
+	if err := s.CreateSession(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SaveRefreshToken(&RefreshTokenType{Token_Hash: hashToken(expired.Session_ID), Session_ID: expired.Session_ID, User_ID: acc.User_ID, Expires_At: now - 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	if active, err := s.GetAllSessions(acc.User_ID, now); err != nil || len(active) != 2 {
+		t.Fatalf("GetAllSessions with expired session got %d, %v", len(active), err)
+	}
+
+	wantError(t, s.RevokeSession(uuid.New().String(), sessions[0].Session_ID, now), KindNotFound, "")
+
+	if err := s.RevokeSession(acc.User_ID, sessions[0].Session_ID, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, err := s.IsTokenRevoked(uuid.New().String(), sessions[0].Session_ID); err != nil || !revoked {
+		t.Fatalf("IsTokenRevoked of revoked session got %v, %v", revoked, err)
+	}
+
+	refresh, err := s.GetRefreshToken(hash)
+	if err != nil || refresh.Revoked_At == nil {
+		t.Fatalf("refresh token of revoked session got %+v, %v", refresh, err)
+	}
+
+	jti := uuid.New().String()
+	if err := s.RevokeToken(jti, now+60); err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, err := s.IsTokenRevoked(jti, sessions[1].Session_ID); err != nil || !revoked {
+		t.Fatalf("IsTokenRevoked of revoked jti got %v, %v", revoked, err)
+	}
+
+	if err := s.RevokeUserSessions(acc.User_ID, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if active, err := s.GetAllSessions(acc.User_ID, now); err != nil || len(active) != 0 {
+		t.Fatalf("GetAllSessions after revoke all got %d, %v", len(active), err)
+	}
+}
+
+func testStorageOutbox(t *testing.T, s Storage) {
+	now := time.Now().Unix()
+	expiresAt := now + 900
+
+	msg := &OutboxMessageType{
+		Outbox_ID:       uuid.New().String(),
+		To:              "alice@example.com",
+		To_Name:         "Alice",
+		Subject:         "sign in",
+		HTML_Body:       "<p>html</p>",
+		Text_Body:       "text",
+		Link:            "https://app.example.com/auth/token",
+		Status:          outboxPending,
+		Next_Attempt_At: now,
+		Created_At:      now,
+		Expires_At:      &expiresAt,
+	}
+
+	if err := s.EnqueueEmail(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := s.GetDueEmails(now, 10)
+	if err != nil || len(due) != 1 || due[0].Link != msg.Link || due[0].Text_Body != "text" || due[0].Expires_At == nil || *due[0].Expires_At != expiresAt {
+		t.Fatalf("GetDueEmails got %+v, %v", due, err)
+	}
+
+	if ok, err := s.ClaimEmail(msg.Outbox_ID, now, now+300); err != nil || !ok {
+		t.Fatalf("first ClaimEmail got %v, %v", ok, err)
+	}
+
+	if ok, err := s.ClaimEmail(msg.Outbox_ID, now, now+300); err != nil || ok {
+		t.Fatalf("second ClaimEmail got %v, %v", ok, err)
+	}
+
+	if due, err := s.GetDueEmails(now, 10); err != nil || len(due) != 0 {
+		t.Fatalf("claimed email is still due: %d, %v", len(due), err)
+	}
+
+	errMsg := "smtp down"
+	msg.Attempts = 1
+	msg.Last_Error = &errMsg
+	msg.Next_Attempt_At = now + 30
+	if err := s.MarkEmailFailed(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	failed, err := s.GetFailedEmails()
+	if err != nil || len(failed) != 1 || failed[0].Attempts != 1 || *failed[0].Last_Error != errMsg {
+		t.Fatalf("GetFailedEmails got %+v, %v", failed, err)
+	}
+
+	if err := s.MarkEmailSent(msg.Outbox_ID, now+30); err != nil {
+		t.Fatal(err)
+	}
+
+	if failed, err := s.GetFailedEmails(); err != nil || len(failed) != 0 {
+		t.Fatalf("sent email is still failed: %d, %v", len(failed), err)
+	}
+}
@@ -5,22 +5,46 @@ import (
 )
 
 type SignUpType struct {
-	User_Name string `json:"user_name"`
-	Email     string `json:"email"`
+	User_Name string `json:"user_name" validate:"required,max=100"`
+	Email     string `json:"email" validate:"required,max=100,email"`
+	Locale    string `json:"locale" validate:"locale"`
 }
 
 type AccountType struct {
 	User_ID   string `json:"user_id"`
 	User_Name string `json:"user_name"`
 	Email     string `json:"email"`
+	Locale    string `json:"locale"`
+	Role      string `json:"role"`
+}
+
+// role of user, every role can do what the lower role can
+const (
+	roleUser   = "user"
+	roleEditor = "editor"
+	roleAdmin  = "admin"
+)
+
+var roleRank = map[string]int{
+	roleUser:   1,
+	roleEditor: 2,
+	roleAdmin:  3,
+}
+
+// change preferred language of email, empty to follow Accept-Language
+type UpdateLocaleType struct {
+	Locale string `json:"locale" validate:"locale"`
 }
 
 type SignInType struct {
-	Email string `json:"email"`
+	Email string `json:"email" validate:"required,max=100,email"`
 }
 
 type ClaimsType struct {
-	User_ID string `json:"user_id"`
+	User_ID    string `json:"user_id"`
+	Token_Type string `json:"token_type"`
+	Session_ID string `json:"sid,omitempty"`
+	Role       string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -32,11 +56,11 @@ type CityType struct {
 	City_Long float64 `json:"city_long"`
 }
 
-// create new city\
+// create new city, pointer so a missing lat or long is not taken as 0
 type CreateNewCityType struct {
-	City_Name string  `json:"city_name"`
-	City_Lat  float64 `json:"city_lat"`
-	City_Long float64 `json:"city_long"`
+	City_Name string   `json:"city_name" validate:"required,max=50"`
+	City_Lat  *float64 `json:"city_lat" validate:"required,lat"`
+	City_Long *float64 `json:"city_long" validate:"required,long"`
 }
 
 // to get destination table
@@ -50,21 +74,21 @@ type DestinationType struct {
 }
 
 type CreateNewDestinationType struct {
-	Destination_Name string  `json:"destination_name"`
-	Destination_URL  string  `json:"destination_url"`
-	Destination_Lat  float64 `json:"destination_lat"`
-	Destination_Long float64 `json:"destination_long"`
-	City_ID          string  `json:"city_id"`
+	Destination_Name string   `json:"destination_name" validate:"required,max=100"`
+	Destination_URL  string   `json:"destination_url" validate:"max=200"`
+	Destination_Lat  *float64 `json:"destination_lat" validate:"required,lat"`
+	Destination_Long *float64 `json:"destination_long" validate:"required,long"`
+	City_ID          string   `json:"city_id" validate:"required,uuid"`
 }
 
-// send data get All Destination
+// send data get All Destination, Image_URL is null if destination has no image
 type AllDestinationType struct {
 	Destination_ID   string  `json:"destination_id"`
 	Destination_Name string  `json:"destination_name"`
 	Destination_URL  string  `json:"destination_url"`
 	Destination_Lat  float64 `json:"destination_lat"`
 	Destination_Long float64 `json:"destination_long"`
-	Image_URL        string  `json:"image_url"`
+	Image_URL        *string `json:"image_url"`
 }
 
 type SendAllDestinationType struct {
@@ -82,8 +106,8 @@ type SendSpecificDestinationType struct {
 }
 
 type CreateNewImageType struct {
-	Image_URL      string `json:"image_url"`
-	Destination_ID string `json:"destination_id"`
+	Image_URL      string `json:"image_url" validate:"required,max=500"`
+	Destination_ID string `json:"destination_id" validate:"required,uuid"`
 }
 
 // to get Image table
@@ -94,14 +118,13 @@ type ImageType struct {
 }
 
 type NewBookmarkType struct {
-	User_ID       string `json:"user_id"`
-	Bookmark_Name string `json:"bookmark_name"`
+	User_ID       string `json:"-"` // owner is the signed in user, never read from the body
+	Bookmark_Name string `json:"bookmark_name" validate:"required,max=50"`
 }
 
 type CreateBookmarkAndSaveType struct {
-	User_ID        string `json:"user_id"`
-	Bookmark_Name  string `json:"bookmark_name"`
-	Destination_ID string `json:"destination_id"`
+	Bookmark_Name  string `json:"bookmark_name" validate:"required,max=50"`
+	Destination_ID string `json:"destination_id" validate:"required,uuid"`
 }
 
 // to get bookmark table
@@ -119,20 +142,97 @@ type User_SaveType struct {
 }
 
 type CreateNewUser_SaveType struct {
-	Destination_ID string `json:"destination_id"`
-	Bookmark_ID    string `json:"bookmark_id"`
+	Destination_ID string `json:"destination_id" validate:"required,uuid"`
+	Bookmark_ID    string `json:"bookmark_id" validate:"required,uuid"`
 }
 
 type SendDataUser_SaveType struct {
-	City_Name        string `json:"city_name"`
-	City_ID          string `json:"city_id"`
-	User_Save_ID     string `json:"user_save_id"`
-	Destination_ID   string `json:"destination_id"`
-	Destination_Name string `json:"destination_name"`
-	Destination_URL  string `json:"destination_url"`
-	Image_URL        string `json:"image_url"`
+	City_Name        string  `json:"city_name"`
+	City_ID          string  `json:"city_id"`
+	User_Save_ID     string  `json:"user_save_id"`
+	Destination_ID   string  `json:"destination_id"`
+	Destination_Name string  `json:"destination_name"`
+	Destination_URL  string  `json:"destination_url"`
+	Image_URL        *string `json:"image_url"`
 }
 
 type UpdateBookmarkNameType struct {
-	Bookmark_Name string `json:"bookmark_name"`
+	Bookmark_Name string `json:"bookmark_name" validate:"required,max=50"`
+}
+
+// email to send
+type MailType struct {
+	To         string `json:"to"`
+	To_Name    string `json:"to_name"`
+	Subject    string `json:"subject"`
+	HTML_Body  string `json:"html_body"`
+	Text_Body  string `json:"text_body"`
+	Link       string `json:"link"`
+	Expires_At int64  `json:"expires_at,omitempty"` // unix time the link expire, 0 never expire
+}
+
+// status of a schema migration
+type MigrationStatusType struct {
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Applied    bool   `json:"applied"`
+	Applied_At string `json:"applied_at"`
+}
+
+// nonce of sign in link
+type MagicLinkType struct {
+	Nonce      string `json:"nonce"`
+	User_ID    string `json:"user_id"`
+	Expires_At int64  `json:"expires_at"`
+}
+
+// refresh token, only the hash of the token is stored
+type RefreshTokenType struct {
+	Token_Hash string `json:"token_hash"`
+	Session_ID string `json:"session_id"`
+	User_ID    string `json:"user_id"`
+	Expires_At int64  `json:"expires_at"`
+	Used_At    *int64 `json:"used_at"`
+	Revoked_At *int64 `json:"revoked_at"`
+}
+
+type RefreshTokenRequestType struct {
+	Refresh_Token string `json:"refresh_token" validate:"max=100"`
+}
+
+// signed in session of user
+type SessionType struct {
+	Session_ID   string `json:"session_id"`
+	User_ID      string `json:"user_id"`
+	User_Agent   string `json:"user_agent"`
+	IP           string `json:"ip"`
+	Created_At   int64  `json:"created_at"`
+	Last_Seen_At int64  `json:"last_seen_at"`
+	Revoked_At   *int64 `json:"-"`
+	Current      bool   `json:"current"`
+}
+
+// status of email in outbox
+const (
+	outboxPending = "pending"
+	outboxSent    = "sent"
+	outboxDead    = "dead"
+)
+
+// email queued in outbox, body and link are not sent to client because they have sign in link
+type OutboxMessageType struct {
+	Outbox_ID       string  `json:"outbox_id"`
+	To              string  `json:"to"`
+	To_Name         string  `json:"to_name"`
+	Subject         string  `json:"subject"`
+	HTML_Body       string  `json:"-"`
+	Text_Body       string  `json:"-"`
+	Link            string  `json:"-"`
+	Status          string  `json:"status"`
+	Attempts        int     `json:"attempts"`
+	Last_Error      *string `json:"last_error"`
+	Next_Attempt_At int64   `json:"next_attempt_at"`
+	Created_At      int64   `json:"created_at"`
+	Expires_At      *int64  `json:"expires_at"`
+	Sent_At         *int64  `json:"sent_at"`
 }
@@ -2,11 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
-	"os"
-
-	"gopkg.in/gomail.v2"
+	"strings"
+	"unicode/utf8"
 )
 
 // Function Helper
@@ -20,129 +22,72 @@ type apiFunc func(w http.ResponseWriter, r *http.Request) error
 
 // error handling
 type ApiError struct {
-	Error string `json:"error"`
+	Error  string            `json:"error"`
+	Code   string            `json:"code,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 func makeHTTPHandleFunc(f apiFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := f(w, r); err != nil {
-			WriteJSON(w, http.StatusBadRequest, ApiError{Error: err.Error()})
+			WriteError(w, err)
 		}
 
 	}
 }
 
-// handle send email
+// max size of request body
+const maxBodySize = 1 << 20
 
-func SendMAIL(email, user_name, token string) error {
+// decode and validate json body, unknown field is not allowed
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
 
-	CONFIG_SMTP_HOST := "smtp.gmail.com"
-	CONFIG_SMTP_PORT := 587
-	CONFIG_AUTH_EMAIL := os.Getenv("EMAIL")
-	CONFIG_AUTH_PASSWORD := os.Getenv("PASSWORD_EMAIL")
-	CONFIG_SENDER_NAME := fmt.Sprintf("RoadTrip <%v>", os.Getenv("EMAIL"))
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
 
-	mailer := gomail.NewMessage()
-	mailer.SetHeader("From", CONFIG_SENDER_NAME)
-	mailer.SetHeader("To", email)
-	mailer.SetAddressHeader("Cc", email, user_name)
-	mailer.SetHeader("Subject", "Sign In Link")
-	mailer.SetBody("text/html", templeteEmail(user_name, token))
+	if err := dec.Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return &AppError{Kind: KindPayloadTooLarge, Code: "body_too_large", Message: fmt.Sprintf("body must be at most %d bytes", maxBodySize), Err: err}
+		}
 
-	dialer := gomail.NewDialer(
-		CONFIG_SMTP_HOST,
-		CONFIG_SMTP_PORT,
-		CONFIG_AUTH_EMAIL,
-		CONFIG_AUTH_PASSWORD,
-	)
+		return &AppError{Kind: KindBadRequest, Code: "invalid_json", Message: "invalid json body: " + err.Error(), Err: err}
+	}
 
-	err := dialer.DialAndSend(mailer)
-	if err != nil {
+	return validate(v)
+}
+
+// same as decodeJSON but an empty body is allowed and leave v as it is.
+// a chunked body has unknown length, so the body is read instead of checking ContentLength
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	if err := decodeJSON(w, r, v); err != nil && !errors.Is(err, io.EOF) {
 		return err
 	}
 
 	return nil
 }
 
-func templeteEmail(user_name, token string) string {
-	return `
-	<table border="0" cellpadding="0" cellspacing="0" width="100%" style="table-layout:fixed;background-color:#f9f9f9" id="bodyTable">
-	<tbody>
-		<tr>
-			<td style="padding-right:10px;padding-left:10px;" align="center" valign="top" id="bodyCell">
-				<table border="0" cellpadding="0" cellspacing="0" width="100%" class="wrapperBody" style="max-width:600px">
-					<tbody>
-						<tr>
-							<td align="center" valign="top">
-								<table border="0" cellpadding="0" cellspacing="0" width="100%" class="tableCard" style="background-color:#fff;border-color:#e5e5e5;border-style:solid;border-width:0 1px 1px 1px;">
-									<tbody>
-										<tr>
-											<td style="background-color:#f87171;font-size:1px;line-height:3px" class="topBorder" height="3">&nbsp;</td>
-										</tr>
-						
-										<tr>
-											<td style="padding: 100px;" align="center" valign="top" class="imgHero">
-													<img alt="" border="0" src="https://res.cloudinary.com/dzdlnbckj/image/upload/v1686126812/xv98t1xt1hbanwpymtos.png" style="width:100%;max-width:600px;height:auto;display:block;color: #f9f9f9;" width="600">
-											</td>
-										</tr>
-										<tr>
-											<td style="padding-bottom: 5px; padding-left: 20px; padding-right: 20px;" align="center" valign="top" class="mainTitle">
-												<h2 class="text" style="color:#000;font-family:Poppins,Helvetica,Arial,sans-serif;font-size:28px;font-weight:500;font-style:normal;letter-spacing:normal;line-height:36px;text-transform:none;text-align:center;padding:0;margin:0">Hi "` + user_name + `"</h2>
-											</td>
-										</tr>
-										<tr>
-											<td style="padding-bottom: 30px; padding-left: 20px; padding-right: 20px;" align="center" valign="top" class="subTitle">
-									
-											</td>
-										</tr>
-										<tr>
-											<td style="padding-left:20px;padding-right:20px" align="center" valign="top" class="containtTable ui-sortable">
-												<table border="0" cellpadding="0" cellspacing="0" width="100%" class="tableDescription" style="">
-													<tbody>
-														<tr>
-															<td style="padding-bottom: 20px;" align="center" valign="top" class="description">
-																<p class="text" style="color:#666;font-family:'Open Sans',Helvetica,Arial,sans-serif;font-size:14px;font-weight:400;font-style:normal;letter-spacing:normal;line-height:22px;text-transform:none;text-align:center;padding:0;margin:0">Thanks for sign in to RoadTrip, click sign in button.</p>
-															</td>
-														</tr>
-													</tbody>
-												</table>
-												<table border="0" cellpadding="0" cellspacing="0" width="100%" class="tableButton" style="">
-													<tbody>
-														<tr>
-															<td style="padding-top:20px;padding-bottom:20px" align="center" valign="top">
-																<table border="0" cellpadding="0" cellspacing="0" align="center">
-																	<tbody>
-																		<tr>
-																			<td style="background-color: rgb(248, 113, 113); padding: 12px 35px; border-radius: 50px;" align="center" class="ctaButton"> <a href="https://roadtrip-laannen-gmailcom.vercel.app/auth/` + token + `" style="color:#fff;font-family:Poppins,Helvetica,Arial,sans-serif;font-size:13px;font-weight:600;font-style:normal;letter-spacing:1px;line-height:20px;text-transform:uppercase;text-decoration:none;display:block" target="_blank" class="text">Sign in</a>
-																			</td>
-																		</tr>
-																	</tbody>
-																</table>
-															</td>
-														</tr>
-													</tbody>
-												</table>
-											</td>
-										</tr>
-										<tr>
-											<td style="font-size:1px;line-height:1px" height="20">&nbsp;</td>
-										</tr>
-									</tbody>
-								</table>
-								<table border="0" cellpadding="0" cellspacing="0" width="100%" class="space">
-									<tbody>
-										<tr>
-											<td style="font-size:1px;line-height:1px" height="30">&nbsp;</td>
-										</tr>
-									</tbody>
-								</table>
-							</td>
-						</tr>
-					</tbody>
-				</table>
-			</td>
-		</tr>
-	</tbody>
-	</table>
-	`
+// ip of client, RealIP middleware already put X-Forwarded-For or X-Real-IP of trusted proxy into RemoteAddr
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// cut string to fit the column
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
+
+// trim and lowercase email so lookup is case insensitive
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// validate struct base on `validate` tag, rules are separated by comma:
+//
+//	required   string must not be empty, pointer must not be nil
+//	max=N      string length must not be more than N
+//	email      string must be an email address
+//	uuid       string must be an uuid
+//	lat        number must be between -90 and 90
+//	long       number must be between -180 and 180
+//	locale     string must be empty or a supported email locale
+//
+// field error use the json name of the field
+func validate(v any) error {
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := map[string]string{}
+	typ := val.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		if msg := checkRules(val.Field(i), strings.Split(tag, ",")); msg != "" {
+			fields[name] = msg
+		}
+	}
+
+	if len(fields) > 0 {
+		return ValidationError(fields, "validation failed")
+	}
+
+	return nil
+}
+
+// return message of the first rule that fail, empty if valid
+func checkRules(v reflect.Value, rules []string) string {
+	// nil pointer is a missing key, only required check it
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			for _, rule := range rules {
+				if rule == "required" {
+					return "is required"
+				}
+			}
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "required":
+			if v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "" {
+				return "is required"
+			}
+		case "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("validate: invalid max rule %q", rule))
+			}
+
+			if utf8.RuneCountInString(v.String()) > n {
+				return fmt.Sprintf("must be at most %d characters", n)
+			}
+		case "email":
+			if s := strings.TrimSpace(v.String()); s != "" {
+				addr, err := mail.ParseAddress(s)
+				if err != nil || addr.Address != s {
+					return "must be a valid email address"
+				}
+			}
+		case "uuid":
+			if s := v.String(); s != "" {
+				if _, err := uuid.Parse(s); err != nil {
+					return "must be a valid uuid"
+				}
+			}
+		case "lat":
+			if f := v.Float(); f < -90 || f > 90 {
+				return "must be between -90 and 90"
+			}
+		case "long":
+			if f := v.Float(); f < -180 || f > 180 {
+				return "must be between -180 and 180"
+			}
+		case "locale":
+			if s := v.String(); s != "" && !isSupportedLocale(s) {
+				return fmt.Sprintf("must be one of %s", strings.Join(supportedLocales, ", "))
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+
+	return ""
+}
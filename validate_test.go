@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLatLong(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		v      any
+		fields map[string]string
+	}{
+		{"city zero coordinate", `{"city_name":"Null Island","city_lat":0,"city_long":0}`, new(CreateNewCityType), nil},
+		{"city missing lat and long", `{"city_name":"Bandung"}`, new(CreateNewCityType), map[string]string{"city_lat": "is required", "city_long": "is required"}},
+		{"city null lat", `{"city_name":"Bandung","city_lat":null,"city_long":107.6}`, new(CreateNewCityType), map[string]string{"city_lat": "is required"}},
+		{"city out of range", `{"city_name":"Bandung","city_lat":-91,"city_long":181}`, new(CreateNewCityType), map[string]string{"city_lat": "must be between -90 and 90", "city_long": "must be between -180 and 180"}},
+		{"destination valid", `{"destination_name":"Kawah Putih","destination_lat":-7.16,"destination_long":107.4,"city_id":"6f1c2a9e-2f0b-4a8e-9a51-0c0d7f2d9b11"}`, new(CreateNewDestinationType), nil},
+		{"destination missing long", `{"destination_name":"Kawah Putih","destination_lat":-7.16,"city_id":"6f1c2a9e-2f0b-4a8e-9a51-0c0d7f2d9b11"}`, new(CreateNewDestinationType), map[string]string{"destination_long": "is required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.body), tt.v); err != nil {
+				t.Fatal(err)
+			}
+
+			err := validate(tt.v)
+
+			var appErr *AppError
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("got error %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.As(err, &appErr) || appErr.Kind != KindValidation {
+				t.Fatalf("got error %v, want validation error", err)
+			}
+
+			if !reflect.DeepEqual(appErr.Fields, tt.fields) {
+				t.Errorf("got fields %v, want %v", appErr.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+// field error of max, email and uuid use the json name of the field
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		v      any
+		fields map[string]string
+	}{
+		{"valid sign up", &SignUpType{User_Name: "Alice", Email: "alice@example.com"}, nil},
+		{"missing field", &SignUpType{Email: "alice@example.com"}, map[string]string{"user_name": "is required"}},
+		{"blank is missing", &SignUpType{User_Name: "   ", Email: "alice@example.com"}, map[string]string{"user_name": "is required"}},
+		{"too long", &SignUpType{User_Name: strings.Repeat("a", 101), Email: "alice@example.com"}, map[string]string{"user_name": "must be at most 100 characters"}},
+		{"max count character not byte", &SignUpType{User_Name: strings.Repeat("é", 100), Email: "alice@example.com"}, nil},
+		{"invalid email", &SignUpType{User_Name: "Alice", Email: "alice"}, map[string]string{"email": "must be a valid email address"}},
+		{"email with name", &SignUpType{User_Name: "Alice", Email: "Alice <alice@example.com>"}, map[string]string{"email": "must be a valid email address"}},
+		{"unsupported locale", &SignUpType{User_Name: "Alice", Email: "alice@example.com", Locale: "fr"}, map[string]string{"locale": "must be one of en, id"}},
+		{"invalid uuid", &CreateBookmarkAndSaveType{Bookmark_Name: "trip", Destination_ID: "123"}, map[string]string{"destination_id": "must be a valid uuid"}},
+		{"every field", &CreateBookmarkAndSaveType{Bookmark_Name: strings.Repeat("a", 51), Destination_ID: "not-a-uuid"}, map[string]string{"bookmark_name": "must be at most 50 characters", "destination_id": "must be a valid uuid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(tt.v)
+
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("got error %v, want nil", err)
+				}
+				return
+			}
+
+			var appErr *AppError
+			if !errors.As(err, &appErr) || appErr.Kind != KindValidation {
+				t.Fatalf("got error %v, want validation error", err)
+			}
+
+			if !reflect.DeepEqual(appErr.Fields, tt.fields) {
+				t.Errorf("got fields %v, want %v", appErr.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+// body is limited to 1MB and unknown field, like the owner of a bookmark, is rejected
+func TestDecodeJSON(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signUp(t, "Alice", "alice@example.com")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		fields map[string]string
+	}{
+		{"valid", `{"bookmark_name":"trip"}`, http.StatusOK, "", nil},
+		{"too large", `{"bookmark_name":"` + strings.Repeat("a", maxBodySize) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large", nil},
+		{"unknown field", `{"bookmark_name":"trip","color":"red"}`, http.StatusBadRequest, "invalid_json", nil},
+		{"owner in body", `{"bookmark_name":"trip","user_id":"6f1c2a9e-2f0b-4a8e-9a51-0c0d7f2d9b11"}`, http.StatusBadRequest, "invalid_json", nil},
+		{"not json", `bookmark_name=trip`, http.StatusBadRequest, "invalid_json", nil},
+		{"wrong type", `{"bookmark_name":1}`, http.StatusBadRequest, "invalid_json", nil},
+		{"too long name", `{"bookmark_name":"` + strings.Repeat("a", 51) + `"}`, http.StatusUnprocessableEntity, "validation_failed", map[string]string{"bookmark_name": "must be at most 50 characters"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", ts.URL+"/bookmark", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			res, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", res.StatusCode, tt.status)
+			}
+
+			if tt.status == http.StatusOK {
+				return
+			}
+
+			var body ApiError
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if body.Code != tt.code || !reflect.DeepEqual(body.Fields, tt.fields) {
+				t.Errorf("got code %s fields %v, want %s %v", body.Code, body.Fields, tt.code, tt.fields)
+			}
+		})
+	}
+}